@@ -0,0 +1,192 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"n3d/constants"
+	"n3d/runtimes"
+	"net"
+	"time"
+)
+
+// Paths of the certificates inside the nodes.
+const (
+	Dir      = "/etc/n3d/tls"
+	CAPath   = Dir + "/ca.pem"
+	CertPath = Dir + "/cert.pem"
+	KeyPath  = Dir + "/key.pem"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 5 * 365 * 24 * time.Hour
+)
+
+type CA struct {
+	CertPEM []byte
+	KeyPEM  []byte
+
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// NodeCerts holds the CA and the certificate of a single node.
+type NodeCerts struct {
+	CA   []byte
+	Cert []byte
+	Key  []byte
+}
+
+// NewCA creates a self signed CA for the cluster.
+func NewCA(clusterName string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate ca key: %w", err)
+	}
+
+	serial, err := serialNumber()
+
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("n3d %s CA", clusterName), Organization: []string{"n3d"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to create ca certificate: %w", err)
+	}
+
+	keyPEM, err := encodeKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadCA(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM)
+}
+
+func LoadCA(certPEM []byte, keyPEM []byte) (*CA, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("unable to decode ca")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse ca certificate: %w", err)
+	}
+
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse ca key: %w", err)
+	}
+
+	return &CA{CertPEM: certPEM, KeyPEM: keyPEM, cert: cert, key: key}, nil
+}
+
+// Issue creates a certificate for the dns names, it is valid for server and
+// client authentication. 127.0.0.1 is always included, so the cluster is
+// reachable through the load balancer from the host.
+func (ca *CA) Issue(commonName string, dnsNames ...string) (*NodeCerts, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate key: %w", err)
+	}
+
+	serial, err := serialNumber()
+
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"n3d"}},
+		DNSNames:     append([]string{commonName, "localhost"}, dnsNames...),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to create certificate for %s: %w", commonName, err)
+	}
+
+	keyPEM, err := encodeKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &NodeCerts{
+		CA:   ca.CertPEM,
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  keyPEM,
+	}, nil
+}
+
+// Files returns the files to write into the node. The key is world readable
+// since the agents drop their root privileges and the files are owned by root.
+func (n *NodeCerts) Files() []*runtimes.FileInNode {
+	return []*runtimes.FileInNode{
+		{Content: n.CA, Path: CAPath, FileMode: 0644},
+		{Content: n.Cert, Path: CertPath, FileMode: 0644},
+		{Content: n.Key, Path: KeyPath, FileMode: 0644},
+	}
+}
+
+// Scheme returns the scheme the APIs of the node are served with.
+func Scheme(node *runtimes.Node) string {
+	if node.Labels[constants.TLS] == "true" {
+		return "https"
+	}
+
+	return "http"
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate serial number: %w", err)
+	}
+
+	return serial, nil
+}
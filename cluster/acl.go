@@ -0,0 +1,43 @@
+package cluster
+
+import (
+	"context"
+	"n3d/consul"
+	"n3d/runtimes"
+	"n3d/state"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ensureConsulTokens creates the consul tokens of vault and nomad which are
+// missing from the state, so a repair doesn't replace working tokens.
+func ensureConsulTokens(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, st *state.ClusterState, timeout time.Duration) error {
+	tokens := []struct {
+		name   string
+		rules  string
+		secret *string
+	}{
+		{"vault", consul.VaultPolicy, &st.ConsulVaultToken},
+		{"nomad-server", consul.NomadServerPolicy, &st.ConsulNomadServerToken},
+		{"nomad-client", consul.NomadClientPolicy, &st.ConsulNomadClientToken},
+	}
+
+	for _, t := range tokens {
+		if *t.secret != "" {
+			continue
+		}
+
+		secret, err := consul.CreateToken(ctx, runtime, node, st.ConsulManagementToken, t.name, t.rules, timeout)
+
+		if err != nil {
+			return err
+		}
+
+		*t.secret = secret
+
+		log.WithContext(ctx).WithField("policy", t.name).Info("consul token created.")
+	}
+
+	return nil
+}
@@ -4,12 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"n3d/certs"
 	"n3d/constants"
 	"n3d/consul"
 	"n3d/loadbalancer"
 	"n3d/nomad"
+	"n3d/registry"
 	"n3d/runtimes"
+	"n3d/state"
 	"n3d/vault"
+	"n3d/versions"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/docker/go-connections/nat"
 	log "github.com/sirupsen/logrus"
@@ -21,31 +29,241 @@ var (
 	ErrorProvisionNomadWorker = errors.New("unable to provision nomad worker")
 	ErrorProvisionVault       = errors.New("unable to provision vault")
 	ErrorGetNetwork           = errors.New("unable to get network")
+	ErrorSaveState            = errors.New("unable to save cluster state")
+	ErrorLoadState            = errors.New("unable to load cluster state")
+	ErrorACLExistingCluster   = errors.New("nomad acl can't be enabled on an existing cluster")
+	ErrorConsulACLExisting    = errors.New("consul acl can't be enabled on an existing cluster")
+	ErrorWorkloadIdentity     = errors.New("workload identity can't be enabled on an existing cluster")
+	ErrorIdentityVersion      = errors.New("workload identity requires nomad 1.7 or newer")
 )
 
 type ClusterConfig struct {
-	ClusterName   string
-	WorkerCount   int
-	ExtraCerts    []string
-	PortsToExpose []string
+	ClusterName       string
+	ServerCount       int
+	WorkerCount       int
+	ConsulServerCount int
+	ExtraCerts        []string
+	PortsToExpose     []string
+	KeepOnFailure     bool
+	ReadyTimeout      time.Duration
+	// APIPortOffset is added to the host ports of the load balancer,
+	// a free offset is allocated when it is nil.
+	APIPortOffset *int
+	Registry      bool
+	RegistryPort  int
+	// RegistryMirror runs a pull through cache of RegistryMirrorRemote for the nomad workers.
+	RegistryMirror       bool
+	RegistryMirrorRemote string
+	// Versions of the components, the defaults of the component packages are used when empty.
+	Versions versions.Versions
+	Images   Images
+	// NomadACL enables the nomad acl system, the bootstrap token is kept in the cluster state.
+	NomadACL bool
+	// ConsulACL enables the consul acl system, vault and nomad get tokens of their own.
+	ConsulACL bool
+	// TLS secures consul, vault and nomad with certificates of a CA generated for the cluster.
+	TLS bool
+	// WorkloadIdentity makes jobs log in to vault with their nomad workload identity.
+	WorkloadIdentity bool
+	// CountsSet tells which node counts were given explicitly, a repaired
+	// cluster keeps the recorded counts of the others.
+	CountsSet NodeCountsSet
+}
+
+type NodeCountsSet struct {
+	Servers       bool
+	Workers       bool
+	ConsulServers bool
+}
+
+type ClusterDeleteOptions struct {
+	// KeepRegistryCache keeps the volume of the registry mirror for the next cluster with the same name.
+	KeepRegistryCache bool
+}
+
+const DefaultReadyTimeout = time.Minute * 2
+
+// readyTimeout is the time given to every component to become ready.
+func (c ClusterConfig) readyTimeout() time.Duration {
+	if c.ReadyTimeout <= 0 {
+		return DefaultReadyTimeout
+	}
+
+	return c.ReadyTimeout
 }
 
 type Cluster struct {
 	config ClusterConfig
 
-	Network      *runtimes.Network
-	NomadServer  *runtimes.Node
-	NomadClients []*runtimes.Node
-	Consul       *runtimes.Node
-	Vault        *vault.VaultNode
-	LoadBalancer *runtimes.Node
-	Volumes      []*runtimes.Volume
+	Network        *runtimes.Network
+	NomadServers   []*runtimes.Node
+	NomadClients   []*runtimes.Node
+	Consul         []*runtimes.Node
+	Vault          *vault.VaultNode
+	LoadBalancer   *runtimes.Node
+	Registry       *runtimes.Node
+	RegistryMirror *runtimes.Node
+	Volumes        []*runtimes.Volume
+	// NomadToken is the nomad acl bootstrap token, empty when acl is disabled.
+	NomadToken string
+	// ConsulToken is the consul management token, empty when acl is disabled.
+	ConsulToken string
+	// CAFile is the path of the CA certificate on the host, empty when tls is disabled.
+	CAFile string
 }
 
-func ClusterCreate(ctx context.Context, config ClusterConfig, runtime runtimes.Runtime) error {
+// ClusterCreate creates the cluster, if parts of the cluster already exist it
+// only creates what is missing and starts the stopped nodes, so it can be used
+// to repair a partially removed cluster without losing its data volumes.
+func ClusterCreate(ctx context.Context, config ClusterConfig, runtime runtimes.Runtime) (err error) {
+	if err := ValidateClusterName(config.ClusterName); err != nil {
+		return err
+	}
+
+	existing, err := ClusterGet(ctx, runtime, config)
+
+	if err != nil {
+		return err
+	}
+
+	stateExisted, err := state.ClusterExists(config.ClusterName)
+
+	if err != nil {
+		return errors.Join(ErrorLoadState, err)
+	}
+
+	repair := existing != nil
+
+	if !repair {
+		// the containers may be pruned while the data of the cluster is kept
+		repair, err = hasClusterData(ctx, runtime, config.ClusterName)
+
+		if err != nil {
+			return err
+		}
+
+		repair = repair || stateExisted
+		existing = &Cluster{config: config}
+	}
+
+	if repair {
+		log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Info("cluster already exists, creating missing resources.")
+	}
+
+	images, err := resolveImages(ctx, config, existing)
+
+	if err != nil {
+		return err
+	}
+
+	st, err := state.LoadCluster(config.ClusterName)
+
+	if err != nil {
+		return errors.Join(ErrorLoadState, err)
+	}
+
+	if config.NomadACL && st.NomadACLToken == "" && len(existing.NomadServers) > 0 {
+		return ErrorACLExistingCluster
+	}
+
+	acl := config.NomadACL || st.NomadACLToken != ""
+
+	if config.ConsulACL && st.ConsulManagementToken == "" && len(existing.Consul) > 0 {
+		return ErrorConsulACLExisting
+	}
+
+	if config.TLS && st.TLSCACert == "" && len(existing.Consul) > 0 {
+		return ErrorTLSExistingCluster
+	}
+
+	if config.WorkloadIdentity && !st.NomadWorkloadIdentity && len(existing.NomadServers) > 0 {
+		return ErrorWorkloadIdentity
+	}
+
+	workloadIdentity := config.WorkloadIdentity || st.NomadWorkloadIdentity
+
+	if workloadIdentity && !versions.AtLeast(images.versions.Nomad, "1.7") {
+		return fmt.Errorf("%w, got %s", ErrorIdentityVersion, images.versions.Nomad)
+	}
+
+	if repair {
+		config = withRecordedCounts(config, st)
+	}
+
+	ports := mergePorts(config.PortsToExpose, existing.exposedPorts())
+	portOffset, err := selectPortOffset(ctx, runtime, config, existing, ports)
+
+	if err != nil {
+		return err
+	}
+
+	tracker := newResourceTracker(runtime)
+	runtime = tracker
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if config.KeepOnFailure {
+			log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Warn("cluster creation failed, keeping created resources.")
+			return
+		}
+
+		log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Warn("cluster creation failed, rolling back.")
+		tracker.rollback()
+
+		// the state holds the vault keys and tokens of the data kept in the volumes
+		if !stateExisted && !repair {
+			_ = state.RemoveCluster(config.ClusterName)
+		}
+	}()
+
+	if config.ConsulACL && st.ConsulManagementToken == "" {
+		st.ConsulManagementToken, err = consul.GenerateToken()
+
+		if err != nil {
+			return err
+		}
+
+		if err := state.SaveCluster(config.ClusterName, st); err != nil {
+			return errors.Join(ErrorSaveState, err)
+		}
+	}
+
+	stateChanged, err := ensureGossipKeys(existing, st)
+
+	if err != nil {
+		return err
+	}
+
+	if workloadIdentity && !st.NomadWorkloadIdentity {
+		st.NomadWorkloadIdentity = true
+		stateChanged = true
+	}
+
+	if recordCounts(st, config.ServerCount, config.WorkerCount, config.ConsulServerCount) {
+		stateChanged = true
+	}
+
+	if stateChanged {
+		if err := state.SaveCluster(config.ClusterName, st); err != nil {
+			return errors.Join(ErrorSaveState, err)
+		}
+	}
+
+	ca, err := ensureCA(config, st)
+
+	if err != nil {
+		return err
+	}
+
 	networkName := config.ClusterName + "-net"
+	if existing.Network != nil {
+		networkName = existing.Network.Name
+	}
 
-	err := runtime.CreateNetwork(ctx, networkName, map[string]string{
+	err = runtime.CreateNetwork(ctx, networkName, map[string]string{
 		constants.ClusterName: config.ClusterName,
 	})
 
@@ -53,76 +271,305 @@ func ClusterCreate(ctx context.Context, config ClusterConfig, runtime runtimes.R
 		return err
 	}
 
-	consul, err := consul.NewConsulServer(ctx, runtime, consul.ConsulConfiguration{
-		ClusterName: config.ClusterName,
-		NetworkName: networkName,
-		Id:          0,
-	})
+	dockerChanged := false
 
-	if err != nil {
+	if existing.Registry != nil {
+		if err := ensureRunning(ctx, runtime, existing.Registry); err != nil {
+			return errors.Join(ErrorProvisionRegistry, err)
+		}
+	} else if config.Registry {
+		existing.Registry, err = newRegistry(ctx, runtime, config.ClusterName, networkName, config.RegistryPort)
+
+		if err != nil {
+			return err
+		}
+
+		dockerChanged = true
+	}
+
+	if existing.RegistryMirror != nil {
+		if err := ensureRunning(ctx, runtime, existing.RegistryMirror); err != nil {
+			return errors.Join(ErrorProvisionRegistry, err)
+		}
+	} else if config.RegistryMirror {
+		existing.RegistryMirror, err = newRegistryMirror(ctx, runtime, config.ClusterName, networkName, config.RegistryMirrorRemote)
+
+		if err != nil {
+			return err
+		}
+
+		dockerChanged = true
+	}
+
+	changed := false
+
+	consulServers := append([]*runtimes.Node{}, existing.Consul...)
+	for i := 0; i < config.ConsulServerCount; i++ {
+		name := consul.ServerName(config.ClusterName, i)
+
+		if n := findNode(existing.Consul, name); n != nil {
+			if err := ensureRunning(ctx, runtime, n); err != nil {
+				return errors.Join(ErrorProvisionConsul, err)
+			}
+
+			continue
+		}
+
+		tls, err := issueCerts(ca, name, consulServerName, consul.ServiceName(config.ClusterName))
+
+		if err != nil {
+			return errors.Join(ErrorProvisionConsul, err)
+		}
+
+		c, err := consul.NewConsulServer(ctx, runtime, consul.ConsulConfiguration{
+			ClusterName:     config.ClusterName,
+			NetworkName:     networkName,
+			Id:              i,
+			ServerCount:     config.ConsulServerCount,
+			Version:         images.versions.Consul,
+			Image:           images.images.Consul,
+			ManagementToken: st.ConsulManagementToken,
+			TLS:             tls,
+			GossipKey:       st.ConsulGossipKey,
+		})
+
+		if err != nil {
+			return errors.Join(ErrorProvisionConsul, err)
+		}
+
+		log.WithContext(ctx).WithField("Name", c.Name).Info("consul started.")
+
+		consulServers = append(consulServers, c)
+		changed = true
+	}
+
+	sortNodes(consulServers)
+	consulAddr := consul.Address(config.ClusterName)
+
+	if err := consul.WaitForLeader(ctx, runtime, consulServers[0], config.readyTimeout()); err != nil {
 		return errors.Join(ErrorProvisionConsul, err)
 	}
 
-	log.WithContext(ctx).WithField("Name", consul.Name).Info("consul started.")
+	log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Info("consul has a leader.")
 
-	vault, err := vault.NewVault(ctx, runtime, vault.VaultConfiguration{
-		ClusterName: config.ClusterName,
-		ConsulAddr:  fmt.Sprintf("%s:8500", consul.Name),
-		Id:          0,
-		NetworkName: networkName,
-	})
+	if st.ConsulManagementToken != "" {
+		if err := ensureConsulTokens(ctx, runtime, consulServers[0], st, config.readyTimeout()); err != nil {
+			return errors.Join(ErrorProvisionConsul, err)
+		}
+
+		if err := state.SaveCluster(config.ClusterName, st); err != nil {
+			return errors.Join(ErrorSaveState, err)
+		}
+	}
+
+	vaultNode, err := ensureVault(ctx, runtime, existing, st, ca, images, consulAddr, networkName)
 
 	if err != nil {
 		return errors.Join(ErrorProvisionVault, err)
 	}
 
-	log.WithContext(ctx).WithFields(log.Fields{
-		"UnsealKey": vault.UnsealKey,
-		"RootToken": vault.RootToken,
-		"Name":      vault.Node.Name,
-	}).Info("vault started.")
-
-	nomadServer, err := nomad.NewNomadServer(ctx, runtime, nomad.NomadConfiguration{
-		NetworkName: networkName,
-		ClusterName: config.ClusterName,
-		ConsulAddr:  fmt.Sprintf("%s:8500", consul.Name),
-		VaultAddr:   fmt.Sprintf("http://%s:8200", vault.Node.Name),
-		VaultToken:  vault.RootToken,
-		Id:          0,
-		ExtraCerts:  config.ExtraCerts,
-	})
+	if existing.Vault == nil {
+		changed = true
+	}
 
-	if err != nil {
+	st.VaultUnsealKey = vaultNode.UnsealKey
+	st.VaultRootToken = vaultNode.RootToken
+
+	if err := state.SaveCluster(config.ClusterName, st); err != nil {
+		return errors.Join(ErrorSaveState, err)
+	}
+
+	// the unseal key and root token stay in the cluster state, see n3d cluster env
+	log.WithContext(ctx).WithField("Name", vaultNode.Node.Name).Info("vault started.")
+
+	if !workloadIdentity && st.VaultNomadToken == "" {
+		st.VaultNomadToken, err = vault.NomadToken(ctx, runtime, vaultNode)
+
+		if err != nil {
+			return errors.Join(ErrorProvisionVault, err)
+		}
+
+		if err := state.SaveCluster(config.ClusterName, st); err != nil {
+			return errors.Join(ErrorSaveState, err)
+		}
+
+		log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Info("vault token for nomad created.")
+	}
+
+	nomadServers := append([]*runtimes.Node{}, existing.NomadServers...)
+	for i := 0; i < config.ServerCount; i++ {
+		name := nomad.ServerName(config.ClusterName, i)
+
+		if n := findNode(existing.NomadServers, name); n != nil {
+			if err := ensureRunning(ctx, runtime, n); err != nil {
+				return errors.Join(ErrorProvisionNomadServer, err)
+			}
+
+			continue
+		}
+
+		tls, err := issueCerts(ca, name, nomadServerName, nomad.ServiceName(config.ClusterName))
+
+		if err != nil {
+			return errors.Join(ErrorProvisionNomadServer, err)
+		}
+
+		s, err := nomad.NewNomadServer(ctx, runtime, nomad.NomadConfiguration{
+			NetworkName: networkName,
+			ClusterName: config.ClusterName,
+			ConsulAddr:  consulAddr,
+			ConsulToken: st.ConsulNomadServerToken,
+			VaultAddr:   vaultAddr(ca, vaultNode.Node.Name),
+			VaultToken:  st.VaultNomadToken,
+			VaultRole:   vault.NomadClusterRole,
+			Id:          i,
+			ServerCount: config.ServerCount,
+			ExtraCerts:  config.ExtraCerts,
+			Version:     images.versions.Nomad,
+			Image:       images.images.NomadServer,
+			ACL:         acl,
+			TLS:         tls,
+			GossipKey:   st.NomadGossipKey,
+
+			WorkloadIdentity: workloadIdentity,
+			VaultAudience:    vault.NomadIdentityAudience,
+		})
+
+		if err != nil {
+			return errors.Join(ErrorProvisionNomadServer, err)
+		}
+
+		log.WithContext(ctx).WithField("name", s.Name).Info("nomad server started.")
+
+		nomadServers = append(nomadServers, s)
+		changed = true
+	}
+
+	sortNodes(nomadServers)
+
+	if err := nomad.WaitForLeader(ctx, runtime, nomadServers[0], config.readyTimeout()); err != nil {
 		return errors.Join(ErrorProvisionNomadServer, err)
 	}
 
-	log.WithContext(ctx).WithField("name", nomadServer.Name).Info("nomad server started.")
+	log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Info("nomad has a leader.")
+
+	if acl {
+		// servers recreated without their volumes have to be bootstrapped again
+		token, err := nomad.ACLBootstrap(ctx, runtime, nomadServers[0], config.readyTimeout())
+
+		switch {
+		case errors.Is(err, nomad.ErrorACLBootstrapped) && st.NomadACLToken != "":
+			log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Debug("nomad acl already bootstrapped, using the stored token.")
+		case err != nil:
+			return errors.Join(ErrorProvisionNomadServer, err)
+		default:
+			st.NomadACLToken = token
+
+			if err := state.SaveCluster(config.ClusterName, st); err != nil {
+				return errors.Join(ErrorSaveState, err)
+			}
+
+			log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Info("nomad acl bootstrapped.")
+		}
+	}
 
-	workers := []string{}
+	if workloadIdentity {
+		// the alias keeps the jwks reachable while one of the servers is down
+		jwksURL := fmt.Sprintf("%s://%s:4646/.well-known/jwks.json", certs.Scheme(nomadServers[0]), nomad.ServiceName(config.ClusterName))
+
+		if err := vault.ConfigureWorkloadIdentity(ctx, runtime, vaultNode, jwksURL, config.readyTimeout()); err != nil {
+			return errors.Join(ErrorProvisionVault, err)
+		}
+
+		log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Info("vault jwt auth of nomad workload identities configured.")
+	}
+
+	workers := append([]*runtimes.Node{}, existing.NomadClients...)
 	for i := 0; i < config.WorkerCount; i++ {
+		name := nomad.ClientName(config.ClusterName, i)
+
+		if n := findNode(existing.NomadClients, name); n != nil {
+			if err := ensureRunning(ctx, runtime, n); err != nil {
+				return errors.Join(ErrorProvisionNomadWorker, err)
+			}
+
+			continue
+		}
+
+		tls, err := issueCerts(ca, name, nomadClientName)
+
+		if err != nil {
+			return errors.Join(ErrorProvisionNomadWorker, err)
+		}
+
 		w, err := nomad.NewNomadClient(ctx, runtime, nomad.NomadConfiguration{
 			NetworkName: networkName,
 			ClusterName: config.ClusterName,
-			ConsulAddr:  fmt.Sprintf("%s:8500", consul.Name),
-			VaultAddr:   fmt.Sprintf("http://%s:8200", vault.Node.Name),
-			VaultToken:  vault.RootToken,
+			ConsulAddr:  consulAddr,
+			ConsulToken: st.ConsulNomadClientToken,
+			VaultAddr:   vaultAddr(ca, vaultNode.Node.Name),
 			Id:          i,
 			ExtraCerts:  config.ExtraCerts,
+			Docker:      existing.dockerConfig(),
+			Version:     images.versions.Nomad,
+			Image:       images.images.NomadClient,
+			ACL:         acl,
+			TLS:         tls,
 		})
 
 		if err != nil {
 			return errors.Join(ErrorProvisionNomadWorker, err)
 		}
 
-		workers = append(workers, w.Name)
+		workers = append(workers, w)
+		changed = true
+	}
+
+	sortNodes(workers)
+
+	// workers created before the registries need to use them
+	if dockerChanged {
+		if err := configureWorkersDocker(ctx, runtime, existing.NomadClients, existing.dockerConfig()); err != nil {
+			return err
+		}
+	} else if err := forwardLocalRegistry(ctx, runtime, existing, existing.NomadClients); err != nil {
+		return errors.Join(ErrorProvisionNomadWorker, err)
+	}
+
+	if err := nomad.WaitForClients(ctx, runtime, nomadServers[0], st.NomadACLToken, len(workers), config.readyTimeout()); err != nil {
+		return errors.Join(ErrorProvisionNomadWorker, err)
 	}
 
-	log.WithContext(ctx).WithField("name", nomadServer.Name).Info("nomad server started.")
+	log.WithContext(ctx).WithField("count", len(workers)).Info("nomad workers ready.")
+
+	if existing.LoadBalancer != nil && !changed && len(ports) == len(existing.exposedPorts()) &&
+		existing.LoadBalancer.Labels[constants.PortOffset] == strconv.Itoa(portOffset) &&
+		(images.images.LoadBalancer == "" || existing.LoadBalancer.Labels[constants.Image] == images.images.LoadBalancer) {
+		if err := ensureRunning(ctx, runtime, existing.LoadBalancer); err != nil {
+			return fmt.Errorf("unable to start load balancer %v", err)
+		}
+
+		log.WithContext(ctx).WithField("cluster-name", config.ClusterName).Info("cluster provisioned.")
+
+		return nil
+	}
+
+	if existing.LoadBalancer != nil {
+		if err := replaceLoadBalancer(ctx, tracker, existing.LoadBalancer, networkName); err != nil {
+			return err
+		}
+	}
+
+	mappings := generatePortMappings(ports, nodeNames(nomadServers), nodeNames(consulServers), vaultNode.Node.Name, nodeNames(workers))
+	lbLabels := applyPortOffset(mappings, portOffset)
+	lbLabels[constants.ExposedPorts] = strings.Join(ports, ",")
 
 	_, err = loadbalancer.NewLoadBalancer(ctx, runtime, loadbalancer.LoadBalancerCreateOptions{
 		NetworkName:  networkName,
 		ClusterName:  config.ClusterName,
-		PortMappings: generatePortMappings(config.PortsToExpose, nomadServer.Name, consul.Name, vault.Node.Name, workers),
+		PortMappings: mappings,
+		Labels:       lbLabels,
+		Image:        images.images.LoadBalancer,
 	})
 
 	if err != nil {
@@ -134,7 +581,137 @@ func ClusterCreate(ctx context.Context, config ClusterConfig, runtime runtimes.R
 	return nil
 }
 
-func ClusterDelete(ctx context.Context, d *Cluster, runtime runtimes.Runtime) error {
+// replaceLoadBalancer removes the load balancer so it can be recreated with
+// other ports, a rollback runs it again with its previous config.
+func replaceLoadBalancer(ctx context.Context, tracker *resourceTracker, lb *runtimes.Node, networkName string) error {
+	lbConfig, err := loadbalancer.ReadConfig(ctx, tracker, lb)
+
+	if err != nil {
+		return fmt.Errorf("unable to replace load balancer %v", err)
+	}
+
+	_ = tracker.StopNode(ctx, lb)
+
+	if err := tracker.RemoveNode(ctx, lb); err != nil {
+		return fmt.Errorf("unable to replace load balancer %v", err)
+	}
+
+	tracker.trackRemoved(lb.Name, func(ctx context.Context, runtime runtimes.Runtime) error {
+		_, err := loadbalancer.Recreate(ctx, runtime, lb, networkName, lbConfig)
+		return err
+	})
+
+	return nil
+}
+
+// withRecordedCounts replaces the node counts which weren't given explicitly
+// with the counts recorded when the cluster was created.
+func withRecordedCounts(config ClusterConfig, st *state.ClusterState) ClusterConfig {
+	if !config.CountsSet.Servers && st.NomadServers != nil {
+		config.ServerCount = *st.NomadServers
+	}
+
+	if !config.CountsSet.Workers && st.NomadWorkers != nil {
+		config.WorkerCount = *st.NomadWorkers
+	}
+
+	if !config.CountsSet.ConsulServers && st.ConsulServers != nil {
+		config.ConsulServerCount = *st.ConsulServers
+	}
+
+	return config
+}
+
+// recordCounts stores the node counts in the state and reports whether they changed.
+func recordCounts(st *state.ClusterState, servers int, workers int, consulServers int) bool {
+	changed := recordCount(&st.NomadServers, servers)
+	changed = recordCount(&st.NomadWorkers, workers) || changed
+	changed = recordCount(&st.ConsulServers, consulServers) || changed
+
+	return changed
+}
+
+func recordCount(recorded **int, count int) bool {
+	if *recorded != nil && **recorded == count {
+		return false
+	}
+
+	*recorded = &count
+
+	return true
+}
+
+// ensureVault starts the existing vault node or creates it, an existing vault
+// is unsealed with the stored key.
+func ensureVault(ctx context.Context, runtime runtimes.Runtime, existing *Cluster, st *state.ClusterState, ca *certs.CA, images *componentImages, consulAddr string, networkName string) (*vault.VaultNode, error) {
+	if existing.Vault != nil {
+		if err := ensureRunning(ctx, runtime, existing.Vault.Node); err != nil {
+			return nil, err
+		}
+
+		return existing.Vault, vault.Unseal(ctx, runtime, existing.Vault, existing.config.readyTimeout())
+	}
+
+	nodeName := vault.NodeName(existing.config.ClusterName, 0)
+	tls, err := issueCerts(ca, nodeName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return vault.NewVault(ctx, runtime, vault.VaultConfiguration{
+		ClusterName:  existing.config.ClusterName,
+		ConsulAddr:   consulAddr,
+		Id:           0,
+		NetworkName:  networkName,
+		UnsealKey:    st.VaultUnsealKey,
+		RootToken:    st.VaultRootToken,
+		ReadyTimeout: existing.config.readyTimeout(),
+		Version:      images.versions.Vault,
+		Image:        images.images.Vault,
+		ConsulToken:  st.ConsulVaultToken,
+		TLS:          tls,
+	})
+}
+
+// hasClusterData reports whether volumes or the network of the cluster exist.
+func hasClusterData(ctx context.Context, runtime runtimes.Runtime, clusterName string) (bool, error) {
+	labels := map[string]string{
+		constants.ClusterName: clusterName,
+	}
+
+	volumes, err := runtime.GetVolumesByLabel(ctx, labels)
+
+	if err != nil {
+		return false, err
+	}
+
+	networks, err := runtime.GetNetworksByLabel(ctx, labels)
+
+	if err != nil {
+		return false, errors.Join(ErrorGetNetwork, err)
+	}
+
+	return len(volumes) > 0 || len(networks) > 0, nil
+}
+
+func ensureRunning(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node) error {
+	if node.IsRunning() {
+		return nil
+	}
+
+	if err := runtime.StartNode(ctx, node); err != nil {
+		return err
+	}
+
+	node.State = "running"
+
+	log.WithContext(ctx).WithField("name", node.Name).Info("started existing node.")
+
+	return nil
+}
+
+func ClusterDelete(ctx context.Context, d *Cluster, runtime runtimes.Runtime, opts ClusterDeleteOptions) error {
 	for _, w := range d.NomadClients {
 		_ = runtime.StopNode(ctx, w)
 
@@ -143,13 +720,13 @@ func ClusterDelete(ctx context.Context, d *Cluster, runtime runtimes.Runtime) er
 
 	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed nomad workers.")
 
-	if d.NomadServer != nil {
-		_ = runtime.StopNode(ctx, d.NomadServer)
-		_ = runtime.RemoveNode(ctx, d.NomadServer)
-
-		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed nomad server.")
+	for _, s := range d.NomadServers {
+		_ = runtime.StopNode(ctx, s)
+		_ = runtime.RemoveNode(ctx, s)
 	}
 
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed nomad servers.")
+
 	if d.Vault != nil {
 		_ = runtime.StopNode(ctx, d.Vault.Node)
 		_ = runtime.RemoveNode(ctx, d.Vault.Node)
@@ -157,19 +734,58 @@ func ClusterDelete(ctx context.Context, d *Cluster, runtime runtimes.Runtime) er
 		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed vault.")
 	}
 
-	if d.Consul != nil {
-		_ = runtime.StopNode(ctx, d.Consul)
-		_ = runtime.RemoveNode(ctx, d.Consul)
+	for _, c := range d.Consul {
+		_ = runtime.StopNode(ctx, c)
+		_ = runtime.RemoveNode(ctx, c)
+	}
 
-		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed consul.")
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed consul.")
+
+	if d.Registry != nil {
+		_ = runtime.StopNode(ctx, d.Registry)
+		_ = runtime.RemoveNode(ctx, d.Registry)
+
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed registry.")
 	}
 
-	_ = removeClusterVolumes(ctx, runtime, d.Volumes)
+	if d.RegistryMirror != nil {
+		_ = runtime.StopNode(ctx, d.RegistryMirror)
+		_ = runtime.RemoveNode(ctx, d.RegistryMirror)
+
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed registry mirror.")
+	}
+
+	volumes := d.Volumes
+
+	if opts.KeepRegistryCache {
+		volumes = make([]*runtimes.Volume, 0, len(d.Volumes))
+
+		for _, v := range d.Volumes {
+			if v.Name != registry.MirrorCacheVolume(d.config.ClusterName) {
+				volumes = append(volumes, v)
+			}
+		}
+
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("keeping registry cache.")
+	}
+
+	_ = removeClusterVolumes(ctx, runtime, volumes)
 	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed volumes.")
 
-	_ = runtime.StopNode(ctx, d.LoadBalancer)
-	_ = runtime.RemoveNode(ctx, d.LoadBalancer)
-	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed loadbalancer.")
+	if d.LoadBalancer != nil {
+		_ = runtime.StopNode(ctx, d.LoadBalancer)
+		_ = runtime.RemoveNode(ctx, d.LoadBalancer)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed loadbalancer.")
+	}
+
+	if d.Network != nil {
+		_ = runtime.DeleteNetwork(ctx, d.Network.Name)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("removed network.")
+	}
+
+	if err := state.RemoveCluster(d.config.ClusterName); err != nil {
+		log.WithContext(ctx).WithError(err).WithField("cluster-name", d.config.ClusterName).Warn("unable to remove cluster state.")
+	}
 
 	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("cluster destroyed.")
 
@@ -192,7 +808,9 @@ func ClusterGet(ctx context.Context, runtime runtimes.Runtime, config ClusterCon
 	}
 
 	cluster := &Cluster{
+		NomadServers: make([]*runtimes.Node, 0),
 		NomadClients: make([]*runtimes.Node, 0),
+		Consul:       make([]*runtimes.Node, 0),
 		config:       config,
 	}
 
@@ -202,23 +820,48 @@ func ClusterGet(ctx context.Context, runtime runtimes.Runtime, config ClusterCon
 
 		switch typ {
 		case constants.NomadServer:
-			cluster.NomadServer = v
+			cluster.NomadServers = append(cluster.NomadServers, v)
 		case constants.NomadClient:
 			cluster.NomadClients = append(cluster.NomadClients, v)
 		case constants.Consul:
-			cluster.Consul = v
+			cluster.Consul = append(cluster.Consul, v)
 		case constants.Vault:
 			cluster.Vault = &vault.VaultNode{
 				Node: v,
-				//TODO find a way to set these to vault
-				//UnsealKey: v.Labels[constants.VaultUnsealKey],
-				//RootToken: v.Labels[constants.VaultRootToken],
 			}
 		case constants.LoadBalancer:
 			cluster.LoadBalancer = v
+		case constants.Registry:
+			cluster.Registry = v
+		case constants.RegistryMirror:
+			cluster.RegistryMirror = v
+		}
+	}
+
+	st, err := state.LoadCluster(config.ClusterName)
+
+	if err != nil {
+		return nil, errors.Join(ErrorLoadState, err)
+	}
+
+	if cluster.Vault != nil {
+		cluster.Vault.UnsealKey = st.VaultUnsealKey
+		cluster.Vault.RootToken = st.VaultRootToken
+	}
+
+	cluster.NomadToken = st.NomadACLToken
+	cluster.ConsulToken = st.ConsulManagementToken
+
+	if st.TLSCACert != "" {
+		if cluster.CAFile, err = state.CAFile(config.ClusterName); err != nil {
+			return nil, err
 		}
 	}
 
+	sortNodes(cluster.NomadServers)
+	sortNodes(cluster.NomadClients)
+	sortNodes(cluster.Consul)
+
 	networks, err := runtime.GetNetworksByLabel(ctx, map[string]string{
 		constants.ClusterName: config.ClusterName,
 	})
@@ -244,6 +887,84 @@ func ClusterGet(ctx context.Context, runtime runtimes.Runtime, config ClusterCon
 	return cluster, nil
 }
 
+// ClusterList returns every cluster that has at least one node, sorted by name.
+func ClusterList(ctx context.Context, runtime runtimes.Runtime) ([]*Cluster, error) {
+	nodes, err := runtime.GetNodesByLabel(ctx, map[string]string{
+		constants.ClusterName: "",
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, v := range nodes {
+		name := v.Labels[constants.ClusterName]
+
+		if name == "" || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	clusters := make([]*Cluster, 0, len(names))
+
+	for _, name := range names {
+		cl, err := ClusterGet(ctx, runtime, ClusterConfig{
+			ClusterName: name,
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch cluster %s: %w", name, err)
+		}
+
+		if cl != nil {
+			clusters = append(clusters, cl)
+		}
+	}
+
+	return clusters, nil
+}
+
+// Name returns the name of the cluster.
+func (c *Cluster) Name() string {
+	return c.config.ClusterName
+}
+
+// Nodes returns every node of the cluster.
+func (c *Cluster) Nodes() []*runtimes.Node {
+	nodes := make([]*runtimes.Node, 0)
+
+	nodes = append(nodes, c.NomadServers...)
+	nodes = append(nodes, c.NomadClients...)
+
+	nodes = append(nodes, c.Consul...)
+
+	if c.Vault != nil {
+		nodes = append(nodes, c.Vault.Node)
+	}
+
+	if c.LoadBalancer != nil {
+		nodes = append(nodes, c.LoadBalancer)
+	}
+
+	if c.Registry != nil {
+		nodes = append(nodes, c.Registry)
+	}
+
+	if c.RegistryMirror != nil {
+		nodes = append(nodes, c.RegistryMirror)
+	}
+
+	return nodes
+}
+
 func ClusterStop(ctx context.Context, d *Cluster, runtime runtimes.Runtime) error {
 	for _, w := range d.NomadClients {
 		_ = runtime.StopNode(ctx, w)
@@ -251,17 +972,35 @@ func ClusterStop(ctx context.Context, d *Cluster, runtime runtimes.Runtime) erro
 
 	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped nomad workers.")
 
-	_ = runtime.StopNode(ctx, d.NomadServer)
-	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped nomad server.")
+	for _, s := range d.NomadServers {
+		_ = runtime.StopNode(ctx, s)
+	}
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped nomad servers.")
 
-	_ = runtime.StopNode(ctx, d.Vault.Node)
-	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped vault.")
+	if d.Vault != nil {
+		_ = runtime.StopNode(ctx, d.Vault.Node)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped vault.")
+	}
 
-	_ = runtime.StopNode(ctx, d.Consul)
+	for _, c := range d.Consul {
+		_ = runtime.StopNode(ctx, c)
+	}
 	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped consul.")
 
-	_ = runtime.StopNode(ctx, d.LoadBalancer)
-	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped loadbalancer.")
+	if d.LoadBalancer != nil {
+		_ = runtime.StopNode(ctx, d.LoadBalancer)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped loadbalancer.")
+	}
+
+	if d.Registry != nil {
+		_ = runtime.StopNode(ctx, d.Registry)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped registry.")
+	}
+
+	if d.RegistryMirror != nil {
+		_ = runtime.StopNode(ctx, d.RegistryMirror)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped registry mirror.")
+	}
 
 	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("stopped cluster.")
 
@@ -270,28 +1009,113 @@ func ClusterStop(ctx context.Context, d *Cluster, runtime runtimes.Runtime) erro
 
 func ClusterStart(ctx context.Context, d *Cluster, runtime runtimes.Runtime) error {
 
-	_ = runtime.StartNode(ctx, d.Consul)
+	if d.Registry != nil {
+		_ = runtime.StartNode(ctx, d.Registry)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started registry.")
+	}
+
+	if d.RegistryMirror != nil {
+		_ = runtime.StartNode(ctx, d.RegistryMirror)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started registry mirror.")
+	}
+
+	for _, c := range d.Consul {
+		_ = runtime.StartNode(ctx, c)
+	}
 	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started consul.")
 
-	_ = runtime.StartNode(ctx, d.Vault.Node)
-	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started vault.")
+	if d.Vault != nil {
+		_ = runtime.StartNode(ctx, d.Vault.Node)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started vault.")
+
+		if err := vault.Unseal(ctx, runtime, d.Vault, d.config.readyTimeout()); err != nil {
+			log.WithContext(ctx).WithError(err).WithField("cluster-name", d.config.ClusterName).Warn("unable to unseal vault.")
+		} else {
+			log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("unsealed vault.")
+		}
+	}
 
-	_ = runtime.StartNode(ctx, d.NomadServer)
-	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started nomad server.")
+	for _, s := range d.NomadServers {
+		_ = runtime.StartNode(ctx, s)
+	}
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started nomad servers.")
 
 	for _, w := range d.NomadClients {
 		_ = runtime.StartNode(ctx, w)
 	}
 	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started nomad workers.")
 
-	_ = runtime.StartNode(ctx, d.LoadBalancer)
-	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started loadbalancer.")
+	if err := forwardLocalRegistry(ctx, runtime, d, d.NomadClients); err != nil {
+		log.WithContext(ctx).WithError(err).WithField("cluster-name", d.config.ClusterName).Warn("unable to forward localhost to the registry.")
+	}
+
+	if d.LoadBalancer != nil {
+		_ = runtime.StartNode(ctx, d.LoadBalancer)
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started loadbalancer.")
+	}
+
+	if d.Vault == nil || d.LoadBalancer == nil {
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Warn("cluster is incomplete, repair it with cluster create.")
+	}
 
 	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("started cluster.")
 
 	return nil
 }
 
+// exposedPorts returns the ports the load balancer exposes on the nomad workers.
+func (c *Cluster) exposedPorts() []string {
+	if c.LoadBalancer == nil || c.LoadBalancer.Labels[constants.ExposedPorts] == "" {
+		return []string{}
+	}
+
+	return strings.Split(c.LoadBalancer.Labels[constants.ExposedPorts], ",")
+}
+
+func mergePorts(ports ...[]string) []string {
+	merged := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, list := range ports {
+		for _, p := range list {
+			if !seen[p] {
+				seen[p] = true
+				merged = append(merged, p)
+			}
+		}
+	}
+
+	sort.Strings(merged)
+
+	return merged
+}
+
+func findNode(nodes []*runtimes.Node, name string) *runtimes.Node {
+	for _, n := range nodes {
+		if n.Name == name {
+			return n
+		}
+	}
+
+	return nil
+}
+
+func nodeNames(nodes []*runtimes.Node) []string {
+	names := make([]string, 0, len(nodes))
+
+	for _, n := range nodes {
+		names = append(names, n.Name)
+	}
+
+	return names
+}
+
+func sortNodes(nodes []*runtimes.Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+}
+
 func removeClusterVolumes(ctx context.Context, runtime runtimes.Runtime, volumes []*runtimes.Volume) error {
 	if len(volumes) == 0 {
 		log.Warn("no volumes found to delete")
@@ -309,21 +1133,17 @@ func removeClusterVolumes(ctx context.Context, runtime runtimes.Runtime, volumes
 	return nil
 }
 
-func generatePortMappings(portsToExpose []string, nomarServer string, consul string, vault string, nomadWorkers []string) []*loadbalancer.PortMapping {
+func generatePortMappings(portsToExpose []string, nomadServers []string, consulServers []string, vault string, nomadWorkers []string) []*loadbalancer.PortMapping {
 	mappings := []*loadbalancer.PortMapping{
 		{
-			Proto: "tcp",
-			Port:  "4646",
-			Servers: []string{
-				nomarServer,
-			},
+			Proto:   "tcp",
+			Port:    "4646",
+			Servers: nomadServers,
 		},
 		{
-			Proto: "tcp",
-			Port:  "8500",
-			Servers: []string{
-				consul,
-			},
+			Proto:   "tcp",
+			Port:    "8500",
+			Servers: consulServers,
 		},
 		{
 			Proto: "tcp",
@@ -334,6 +1154,8 @@ func generatePortMappings(portsToExpose []string, nomarServer string, consul str
 		},
 	}
 
+	// exposed ports are published even without workers, the load balancer
+	// starts serving them once workers are added
 	for _, v := range portsToExpose {
 		mappings = append(mappings, &loadbalancer.PortMapping{
 			Proto:   "tcp",
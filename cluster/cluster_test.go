@@ -0,0 +1,27 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergePorts(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports [][]string
+		want  []string
+	}{
+		{name: "none", want: []string{}},
+		{name: "single list", ports: [][]string{{"8080", "80"}}, want: []string{"80", "8080"}},
+		{name: "duplicates", ports: [][]string{{"80", "443"}, {"443", "80", "9090"}}, want: []string{"443", "80", "9090"}},
+		{name: "empty lists", ports: [][]string{{}, {"80"}, nil}, want: []string{"80"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergePorts(tt.ports...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergePorts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
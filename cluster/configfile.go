@@ -0,0 +1,294 @@
+package cluster
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"n3d/registry"
+	"n3d/state"
+	"n3d/versions"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFileAPIVersion = "n3d/v1alpha1"
+	ConfigFileKind       = "Cluster"
+)
+
+var clusterNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ValidateClusterName checks that the name can be used in container names and state paths.
+func ValidateClusterName(name string) error {
+	if !clusterNameRegexp.MatchString(name) {
+		return fmt.Errorf("%w: %q", state.ErrorInvalidClusterName, name)
+	}
+
+	return nil
+}
+
+// ConfigFileError points to the field of a cluster config file that failed validation.
+type ConfigFileError struct {
+	File  string
+	Line  int
+	Field string
+	Msg   string
+}
+
+func (e *ConfigFileError) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, e.Field, e.Msg)
+}
+
+type clusterFile struct {
+	APIVersion    string             `yaml:"apiVersion"`
+	Kind          string             `yaml:"kind"`
+	Name          string             `yaml:"name"`
+	Nomad         nomadFileConfig    `yaml:"nomad"`
+	Consul        consulFileConfig   `yaml:"consul"`
+	Vault         vaultFileConfig    `yaml:"vault"`
+	LoadBalancer  lbFileConfig       `yaml:"loadBalancer"`
+	Ports         []string           `yaml:"ports"`
+	APIPortOffset *int               `yaml:"apiPortOffset"`
+	Registry      registryFileConfig `yaml:"registry"`
+	TLS           bool               `yaml:"tls"`
+}
+
+type registryFileConfig struct {
+	Enabled bool             `yaml:"enabled"`
+	Port    *int             `yaml:"port"`
+	Mirror  mirrorFileConfig `yaml:"mirror"`
+}
+
+type mirrorFileConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	RemoteURL string `yaml:"remoteURL"`
+}
+
+type consulFileConfig struct {
+	Servers *int   `yaml:"servers"`
+	Version string `yaml:"version"`
+	Image   string `yaml:"image"`
+	ACL     bool   `yaml:"acl"`
+}
+
+type vaultFileConfig struct {
+	Version string `yaml:"version"`
+	Image   string `yaml:"image"`
+}
+
+type lbFileConfig struct {
+	Image string `yaml:"image"`
+}
+
+type nomadFileConfig struct {
+	Servers     *int     `yaml:"servers"`
+	Workers     *int     `yaml:"workers"`
+	ExtraCerts  []string `yaml:"extraCerts"`
+	Version     string   `yaml:"version"`
+	ServerImage string   `yaml:"serverImage"`
+	ClientImage string   `yaml:"clientImage"`
+	ACL         bool     `yaml:"acl"`
+	// WorkloadIdentity configures the vault integration with workload identities.
+	WorkloadIdentity bool `yaml:"workloadIdentity"`
+}
+
+// LoadConfigFile reads a declarative cluster definition and maps it onto ClusterConfig.
+// Relative paths in the file are resolved against the directory of the file.
+func LoadConfigFile(path string) (*ClusterConfig, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(content, root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	file := &clusterFile{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	v := &configFileValidator{path: path, root: root}
+	v.validate(file)
+
+	if len(v.errs) > 0 {
+		return nil, errors.Join(v.errs...)
+	}
+
+	config := &ClusterConfig{
+		ClusterName:          file.Name,
+		ServerCount:          1,
+		WorkerCount:          1,
+		ConsulServerCount:    1,
+		PortsToExpose:        file.Ports,
+		APIPortOffset:        file.APIPortOffset,
+		Registry:             file.Registry.Enabled,
+		RegistryPort:         registry.DefaultPort,
+		RegistryMirror:       file.Registry.Mirror.Enabled,
+		RegistryMirrorRemote: registry.DefaultRemoteURL,
+		NomadACL:             file.Nomad.ACL,
+		ConsulACL:            file.Consul.ACL,
+		TLS:                  file.TLS,
+		WorkloadIdentity:     file.Nomad.WorkloadIdentity,
+		Versions: versions.Versions{
+			Nomad:  file.Nomad.Version,
+			Consul: file.Consul.Version,
+			Vault:  file.Vault.Version,
+		},
+		Images: Images{
+			NomadServer:  file.Nomad.ServerImage,
+			NomadClient:  file.Nomad.ClientImage,
+			Consul:       file.Consul.Image,
+			Vault:        file.Vault.Image,
+			LoadBalancer: file.LoadBalancer.Image,
+		},
+	}
+
+	if file.Registry.Mirror.RemoteURL != "" {
+		config.RegistryMirrorRemote = file.Registry.Mirror.RemoteURL
+	}
+
+	if file.Registry.Port != nil {
+		config.RegistryPort = *file.Registry.Port
+	}
+
+	if file.Consul.Servers != nil {
+		config.ConsulServerCount = *file.Consul.Servers
+		config.CountsSet.ConsulServers = true
+	}
+
+	if file.Nomad.Servers != nil {
+		config.ServerCount = *file.Nomad.Servers
+		config.CountsSet.Servers = true
+	}
+
+	if file.Nomad.Workers != nil {
+		config.WorkerCount = *file.Nomad.Workers
+		config.CountsSet.Workers = true
+	}
+
+	baseDir := filepath.Dir(path)
+	for _, c := range file.Nomad.ExtraCerts {
+		if !filepath.IsAbs(c) {
+			c = filepath.Join(baseDir, c)
+		}
+
+		config.ExtraCerts = append(config.ExtraCerts, c)
+	}
+
+	return config, nil
+}
+
+type configFileValidator struct {
+	path string
+	root *yaml.Node
+	errs []error
+}
+
+func (v *configFileValidator) validate(file *clusterFile) {
+	if file.APIVersion != ConfigFileAPIVersion {
+		v.fail("apiVersion", fmt.Sprintf("unsupported version %q, expected %q", file.APIVersion, ConfigFileAPIVersion))
+	}
+
+	if file.Kind != ConfigFileKind {
+		v.fail("kind", fmt.Sprintf("unsupported kind %q, expected %q", file.Kind, ConfigFileKind))
+	}
+
+	if file.Name != "" && !clusterNameRegexp.MatchString(file.Name) {
+		v.fail("name", fmt.Sprintf("invalid cluster name %q", file.Name))
+	}
+
+	if file.Nomad.Servers != nil && *file.Nomad.Servers < 1 {
+		v.fail("nomad.servers", "at least one server is required")
+	}
+
+	if file.Consul.Servers != nil && *file.Consul.Servers < 1 {
+		v.fail("consul.servers", "at least one server is required")
+	}
+
+	if file.Nomad.Workers != nil && *file.Nomad.Workers < 0 {
+		v.fail("nomad.workers", "must not be negative")
+	}
+
+	for i, c := range file.Nomad.ExtraCerts {
+		if !filepath.IsAbs(c) {
+			c = filepath.Join(filepath.Dir(v.path), c)
+		}
+
+		if _, err := os.Stat(c); err != nil {
+			v.fail(fmt.Sprintf("nomad.extraCerts.%d", i), fmt.Sprintf("certificate not found: %s", c))
+		}
+	}
+
+	if file.APIPortOffset != nil && (*file.APIPortOffset < 0 || *file.APIPortOffset > 65535) {
+		v.fail("apiPortOffset", "must be between 0 and 65535")
+	}
+
+	if file.Registry.Port != nil && (*file.Registry.Port < 1 || *file.Registry.Port > 65535) {
+		v.fail("registry.port", "must be between 1 and 65535")
+	}
+
+	if u := file.Registry.Mirror.RemoteURL; u != "" && !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		v.fail("registry.mirror.remoteURL", fmt.Sprintf("invalid url %q", u))
+	}
+
+	for i, p := range file.Ports {
+		port, err := strconv.Atoi(p)
+
+		if err != nil || port < 1 || port > 65535 {
+			v.fail(fmt.Sprintf("ports.%d", i), fmt.Sprintf("invalid port %q", p))
+		}
+	}
+}
+
+func (v *configFileValidator) fail(field string, msg string) {
+	v.errs = append(v.errs, &ConfigFileError{
+		File:  v.path,
+		Line:  lineOf(v.root, strings.Split(field, ".")),
+		Field: field,
+		Msg:   msg,
+	})
+}
+
+// lineOf returns the line of the deepest node that exists on the given path.
+func lineOf(node *yaml.Node, path []string) int {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		return lineOf(node.Content[0], path)
+	}
+
+	if len(path) == 0 {
+		return node.Line
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == path[0] {
+				if len(path) == 1 {
+					return node.Content[i].Line
+				}
+
+				return lineOf(node.Content[i+1], path[1:])
+			}
+		}
+	case yaml.SequenceNode:
+		idx, err := strconv.Atoi(path[0])
+
+		if err == nil && idx < len(node.Content) {
+			return lineOf(node.Content[idx], path[1:])
+		}
+	}
+
+	return node.Line
+}
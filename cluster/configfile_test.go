@@ -0,0 +1,203 @@
+package cluster
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "cluster.yaml")
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// configFileErrors returns the validation errors of a LoadConfigFile error.
+func configFileErrors(err error) []*ConfigFileError {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	found := make([]*ConfigFileError, 0, len(errs))
+	for _, e := range errs {
+		var cfErr *ConfigFileError
+		if errors.As(e, &cfErr) {
+			found = append(found, cfErr)
+		}
+	}
+
+	return found
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `apiVersion: n3d/v1alpha1
+kind: Cluster
+name: test
+tls: true
+nomad:
+  servers: 3
+  workers: 0
+  version: 1.7.2
+  acl: true
+  workloadIdentity: true
+consul:
+  servers: 3
+registry:
+  enabled: true
+  port: 5001
+ports:
+  - "8080"
+apiPortOffset: 10
+`)
+
+	config, err := LoadConfigFile(path)
+
+	if err != nil {
+		t.Fatalf("LoadConfigFile() error = %v", err)
+	}
+
+	checks := map[string][2]interface{}{
+		"ClusterName":       {config.ClusterName, "test"},
+		"ServerCount":       {config.ServerCount, 3},
+		"WorkerCount":       {config.WorkerCount, 0},
+		"ConsulServerCount": {config.ConsulServerCount, 3},
+		"PortsToExpose":     {config.PortsToExpose, []string{"8080"}},
+		"APIPortOffset":     {*config.APIPortOffset, 10},
+		"Registry":          {config.Registry, true},
+		"RegistryPort":      {config.RegistryPort, 5001},
+		"NomadACL":          {config.NomadACL, true},
+		"TLS":               {config.TLS, true},
+		"WorkloadIdentity":  {config.WorkloadIdentity, true},
+		"Versions.Nomad":    {config.Versions.Nomad, "1.7.2"},
+	}
+
+	for field, c := range checks {
+		if !reflect.DeepEqual(c[0], c[1]) {
+			t.Errorf("%s = %v, want %v", field, c[0], c[1])
+		}
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	type fieldError struct {
+		field string
+		line  int
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []fieldError
+		// wantMsg is checked for errors which aren't validation errors.
+		wantMsg string
+	}{
+		{
+			name:    "unsupported api version and kind",
+			content: "apiVersion: n3d/v2\nkind: Node\n",
+			want:    []fieldError{{"apiVersion", 1}, {"kind", 2}},
+		},
+		{
+			name:    "invalid name",
+			content: "apiVersion: n3d/v1alpha1\nkind: Cluster\nname: -test\n",
+			want:    []fieldError{{"name", 3}},
+		},
+		{
+			name: "nested fields",
+			content: `apiVersion: n3d/v1alpha1
+kind: Cluster
+nomad:
+  servers: 0
+  workers: -1
+consul:
+  servers: 0
+`,
+			want: []fieldError{{"nomad.servers", 4}, {"consul.servers", 7}, {"nomad.workers", 5}},
+		},
+		{
+			name: "list items",
+			content: `apiVersion: n3d/v1alpha1
+kind: Cluster
+ports:
+  - "8080"
+  - "http"
+  - "70000"
+`,
+			want: []fieldError{{"ports.1", 5}, {"ports.2", 6}},
+		},
+		{
+			name: "registry",
+			content: `apiVersion: n3d/v1alpha1
+kind: Cluster
+apiPortOffset: -1
+registry:
+  port: 0
+  mirror:
+    remoteURL: registry.example.com
+`,
+			want: []fieldError{{"apiPortOffset", 3}, {"registry.port", 5}, {"registry.mirror.remoteURL", 7}},
+		},
+		{
+			name: "missing extra cert",
+			content: `apiVersion: n3d/v1alpha1
+kind: Cluster
+nomad:
+  extraCerts:
+    - ca.pem
+`,
+			want: []fieldError{{"nomad.extraCerts.0", 5}},
+		},
+		{
+			name:    "unknown field",
+			content: "apiVersion: n3d/v1alpha1\nkind: Cluster\nnomad:\n  server: 1\n",
+			wantMsg: "field server not found",
+		},
+		{
+			name:    "invalid yaml",
+			content: "apiVersion: [\n",
+			wantMsg: "yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.content)
+
+			_, err := LoadConfigFile(path)
+
+			if err == nil {
+				t.Fatal("LoadConfigFile() expected an error")
+			}
+
+			if tt.wantMsg != "" {
+				if !strings.Contains(err.Error(), tt.wantMsg) {
+					t.Errorf("LoadConfigFile() error = %v, want %q", err, tt.wantMsg)
+				}
+
+				return
+			}
+
+			got := make([]fieldError, 0)
+			for _, e := range configFileErrors(err) {
+				if e.File != path {
+					t.Errorf("error file = %s, want %s", e.File, path)
+				}
+
+				got = append(got, fieldError{e.Field, e.Line})
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadConfigFile() errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
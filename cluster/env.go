@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"fmt"
+	"n3d/constants"
+	"strings"
+)
+
+const (
+	NomadPort  = "4646"
+	ConsulPort = "8500"
+	VaultPort  = "8200"
+)
+
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// Env returns the environment variables which configure the nomad, consul
+// and vault CLIs to use the cluster through its load balancer.
+func (c *Cluster) Env() []EnvVar {
+	scheme := "http"
+	if c.CAFile != "" {
+		scheme = "https"
+	}
+
+	env := []EnvVar{
+		{Name: "NOMAD_ADDR", Value: fmt.Sprintf("%s://127.0.0.1:%s", scheme, c.HostPort(NomadPort))},
+		{Name: "CONSUL_HTTP_ADDR", Value: fmt.Sprintf("%s://127.0.0.1:%s", scheme, c.HostPort(ConsulPort))},
+		{Name: "VAULT_ADDR", Value: fmt.Sprintf("%s://127.0.0.1:%s", scheme, c.HostPort(VaultPort))},
+	}
+
+	if c.CAFile != "" {
+		env = append(env,
+			EnvVar{Name: "NOMAD_CACERT", Value: c.CAFile},
+			EnvVar{Name: "CONSUL_CACERT", Value: c.CAFile},
+			EnvVar{Name: "VAULT_CACERT", Value: c.CAFile},
+		)
+	}
+
+	if c.Vault != nil && c.Vault.RootToken != "" {
+		env = append(env, EnvVar{Name: "VAULT_TOKEN", Value: c.Vault.RootToken})
+	}
+
+	if c.ConsulToken != "" {
+		env = append(env, EnvVar{Name: "CONSUL_HTTP_TOKEN", Value: c.ConsulToken})
+	}
+
+	if c.NomadToken != "" {
+		env = append(env, EnvVar{Name: "NOMAD_TOKEN", Value: c.NomadToken})
+	}
+
+	return env
+}
+
+// HostPort returns the host port the load balancer publishes the given port on.
+func (c *Cluster) HostPort(port string) string {
+	if p, ok := c.HostPorts()[port]; ok {
+		return p
+	}
+
+	return port
+}
+
+// HostPorts maps the load balancer ports to the host ports they are published on,
+// the ports recorded on the labels are used when the load balancer isn't running.
+func (c *Cluster) HostPorts() map[string]string {
+	ports := make(map[string]string)
+
+	if c.LoadBalancer == nil {
+		return ports
+	}
+
+	for k, v := range c.LoadBalancer.Labels {
+		if strings.HasPrefix(k, constants.HostPortLabelPrefix) {
+			ports[strings.TrimPrefix(k, constants.HostPortLabelPrefix)] = v
+		}
+	}
+
+	for port, bindings := range c.LoadBalancer.Ports {
+		for _, b := range bindings {
+			if b.HostPort != "" {
+				ports[port.Port()] = b.HostPort
+			}
+		}
+	}
+
+	return ports
+}
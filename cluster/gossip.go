@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"n3d/state"
+)
+
+// ensureGossipKeys generates the gossip keys of a new cluster. Clusters
+// created without encryption keep gossiping in plain text, servers with a key
+// can't join the existing ones.
+func ensureGossipKeys(existing *Cluster, st *state.ClusterState) (bool, error) {
+	changed := false
+
+	if st.ConsulGossipKey == "" && len(existing.Consul) == 0 {
+		key, err := generateGossipKey()
+
+		if err != nil {
+			return false, err
+		}
+
+		st.ConsulGossipKey = key
+		changed = true
+	}
+
+	if st.NomadGossipKey == "" && len(existing.NomadServers) == 0 {
+		key, err := generateGossipKey()
+
+		if err != nil {
+			return false, err
+		}
+
+		st.NomadGossipKey = key
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// generateGossipKey returns a random 32 byte key, which both consul and nomad accept.
+func generateGossipKey() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate gossip key: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"n3d/nomad"
+	"n3d/runtimes"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrorNoNomadClients = errors.New("cluster has no nomad clients")
+
+// ImageImport saves the images from the host daemon once and loads them into
+// the docker daemon of every nomad client in parallel.
+func ImageImport(ctx context.Context, d *Cluster, runtime runtimes.Runtime, images []string) error {
+	if len(d.NomadClients) == 0 {
+		return ErrorNoNomadClients
+	}
+
+	for _, w := range d.NomadClients {
+		if !w.IsRunning() {
+			return fmt.Errorf("nomad worker %s is not running", w.Name)
+		}
+	}
+
+	archive, err := saveImages(ctx, runtime, images)
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(archive)
+
+	log.WithContext(ctx).WithField("images", images).Info("images saved from host.")
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(d.NomadClients))
+
+	for i, w := range d.NomadClients {
+		wg.Add(1)
+
+		go func(i int, w *runtimes.Node) {
+			defer wg.Done()
+
+			f, err := os.Open(archive)
+
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			defer f.Close()
+
+			if err := nomad.LoadImages(ctx, runtime, w, f); err != nil {
+				errs[i] = err
+				return
+			}
+
+			log.WithContext(ctx).WithField("name", w.Name).Info("images imported.")
+		}(i, w)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// saveImages writes the docker save archive to a temporary file, so it is
+// read from the host daemon only once.
+func saveImages(ctx context.Context, runtime runtimes.Runtime, images []string) (string, error) {
+	reader, err := runtime.SaveImages(ctx, images)
+
+	if err != nil {
+		return "", fmt.Errorf("unable to save images: %w", err)
+	}
+
+	defer reader.Close()
+
+	f, err := os.CreateTemp("", "n3d-images-*.tar")
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	if _, err := io.Copy(f, reader); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("unable to save images: %w", err)
+	}
+
+	return f.Name(), nil
+}
@@ -0,0 +1,243 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"n3d/nomad"
+	"n3d/wait"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrorPlacementFailed = errors.New("allocations couldn't be placed")
+	ErrorEvalFailed      = errors.New("evaluation failed")
+	ErrorDeployFailed    = errors.New("deployment failed")
+)
+
+// NomadAPI returns a client of the nomad api published by the load balancer.
+func (c *Cluster) NomadAPI(token string) (*nomad.APIClient, error) {
+	if c.LoadBalancer == nil || !c.LoadBalancer.IsRunning() {
+		return nil, fmt.Errorf("%w: load balancer isn't running", ErrorClusterIncomplete)
+	}
+
+	scheme := "http"
+	if c.CAFile != "" {
+		scheme = "https"
+	}
+
+	return nomad.NewAPIClient(fmt.Sprintf("%s://127.0.0.1:%s", scheme, c.HostPort(NomadPort)), token, c.CAFile)
+}
+
+// LoadJob reads a jobspec file, hcl is parsed by nomad. json files hold either
+// the job or the job wrapped in a Job field, like nomad job run -json expects.
+func LoadJob(ctx context.Context, api *nomad.APIClient, path string) (nomad.Job, *nomad.JobRef, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read jobspec: %w", err)
+	}
+
+	var job nomad.Job
+
+	if strings.HasSuffix(path, ".json") || bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		wrapped := struct {
+			Job nomad.Job `json:"Job"`
+		}{}
+
+		if err := json.Unmarshal(content, &wrapped); err != nil {
+			return nil, nil, fmt.Errorf("unable to parse jobspec %s: %w", path, err)
+		}
+
+		job = wrapped.Job
+		if job == nil {
+			job = content
+		}
+	} else {
+		job, err = api.ParseJob(ctx, string(content))
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse jobspec %s: %w", path, err)
+		}
+	}
+
+	ref, err := nomad.ReadJobRef(job)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid jobspec %s: %w", path, err)
+	}
+
+	return job, ref, nil
+}
+
+// JobPlan runs a dry run of the job, it fails when allocations can't be placed.
+func JobPlan(ctx context.Context, api *nomad.APIClient, ref *nomad.JobRef, job nomad.Job) (*nomad.PlanResponse, error) {
+	plan, err := api.PlanJob(ctx, ref, job)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plan.FailedTGAllocs) > 0 {
+		return plan, fmt.Errorf("%w: %s", ErrorPlacementFailed, placementFailures(plan.FailedTGAllocs))
+	}
+
+	return plan, nil
+}
+
+type JobRunOptions struct {
+	Timeout time.Duration
+	// Detach returns once the job is registered.
+	Detach bool
+}
+
+// JobRun registers the job and waits until its evaluation is processed and,
+// for jobs with a deployment, until the deployment is healthy.
+func JobRun(ctx context.Context, api *nomad.APIClient, ref *nomad.JobRef, job nomad.Job, opts JobRunOptions) error {
+	resp, err := api.RegisterJob(ctx, ref, job)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.Warnings != "" {
+		log.WithContext(ctx).WithField("job", ref.ID).Warn(resp.Warnings)
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{"job": ref.ID, "eval": resp.EvalID}).Info("job registered.")
+
+	// periodic and parameterized jobs aren't evaluated when they are registered
+	if opts.Detach || resp.EvalID == "" {
+		return nil
+	}
+
+	eval, err := waitForEval(ctx, api, ref.Namespace, resp.EvalID, opts.Timeout)
+
+	if err != nil {
+		return err
+	}
+
+	if eval.DeploymentID == "" {
+		log.WithContext(ctx).WithField("job", ref.ID).Info("job placed.")
+		return nil
+	}
+
+	return waitForDeployment(ctx, api, ref, eval.DeploymentID, opts.Timeout)
+}
+
+// JobStop stops the job and waits until its allocations are stopped.
+func JobStop(ctx context.Context, api *nomad.APIClient, ref *nomad.JobRef, purge bool, timeout time.Duration) error {
+	evalID, err := api.StopJob(ctx, ref, purge)
+
+	if err != nil {
+		return err
+	}
+
+	if evalID == "" {
+		return nil
+	}
+
+	if _, err := waitForEval(ctx, api, ref.Namespace, evalID, timeout); err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).WithField("job", ref.ID).Info("job stopped.")
+
+	return nil
+}
+
+func waitForEval(ctx context.Context, api *nomad.APIClient, namespace string, id string, timeout time.Duration) (*nomad.Evaluation, error) {
+	var eval *nomad.Evaluation
+
+	err := wait.For(ctx, "nomad evaluation", timeout, func(ctx context.Context) (bool, error) {
+		e, err := api.Evaluation(ctx, namespace, id)
+
+		if err != nil {
+			return false, err
+		}
+
+		eval = e
+
+		return e.Status != "pending" && e.Status != "blocked", nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if eval.Status != "complete" {
+		return nil, fmt.Errorf("%w: evaluation %s is %s: %s", ErrorEvalFailed, id, eval.Status, eval.StatusDescription)
+	}
+
+	if len(eval.FailedTGAllocs) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrorPlacementFailed, placementFailures(eval.FailedTGAllocs))
+	}
+
+	return eval, nil
+}
+
+func waitForDeployment(ctx context.Context, api *nomad.APIClient, ref *nomad.JobRef, id string, timeout time.Duration) error {
+	var deployment *nomad.Deployment
+
+	log.WithContext(ctx).WithFields(log.Fields{"job": ref.ID, "deployment": id}).Info("waiting for deployment.")
+
+	err := wait.For(ctx, "nomad deployment", timeout, func(ctx context.Context) (bool, error) {
+		d, err := api.Deployment(ctx, ref.Namespace, id)
+
+		if err != nil {
+			return false, err
+		}
+
+		deployment = d
+
+		return d.Status != "running" && d.Status != "pending" && d.Status != "paused", nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if deployment.Status != "successful" {
+		return fmt.Errorf("%w: deployment %s is %s: %s", ErrorDeployFailed, id, deployment.Status, deployment.StatusDescription)
+	}
+
+	log.WithContext(ctx).WithField("job", ref.ID).Info("deployment successful.")
+
+	return nil
+}
+
+// placementFailures summarizes the failed allocations of every task group.
+func placementFailures(failed map[string]*nomad.AllocationMetric) string {
+	groups := make([]string, 0, len(failed))
+	for group := range failed {
+		groups = append(groups, group)
+	}
+
+	sort.Strings(groups)
+
+	summaries := make([]string, 0, len(groups))
+	for _, group := range groups {
+		m := failed[group]
+		reasons := []string{fmt.Sprintf("%d nodes evaluated", m.NodesEvaluated)}
+
+		for reason, count := range m.ConstraintFiltered {
+			reasons = append(reasons, fmt.Sprintf("%d filtered by %s", count, reason))
+		}
+
+		for dimension, count := range m.DimensionExhausted {
+			reasons = append(reasons, fmt.Sprintf("%d exhausted %s", count, dimension))
+		}
+
+		sort.Strings(reasons[1:])
+		summaries = append(summaries, fmt.Sprintf("%s (%s)", group, strings.Join(reasons, ", ")))
+	}
+
+	return strings.Join(summaries, "; ")
+}
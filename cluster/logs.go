@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"n3d/runtimes"
+	"sync"
+)
+
+// FindNodes returns the nodes with the given names, the cluster name prefix
+// can be omitted. All nodes are returned when no name is given.
+func (c *Cluster) FindNodes(names []string) ([]*runtimes.Node, error) {
+	if len(names) == 0 {
+		return c.Nodes(), nil
+	}
+
+	nodes := make([]*runtimes.Node, 0, len(names))
+
+	for _, name := range names {
+		node := findNode(c.Nodes(), name)
+
+		if node == nil {
+			node = findNode(c.Nodes(), fmt.Sprintf("%s-%s", c.Name(), name))
+		}
+
+		if node == nil {
+			return nil, fmt.Errorf("%w: %s", ErrorNodeNotFound, name)
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// NodeLogs streams the logs of the nodes concurrently, output returns the
+// stdout and stderr writers of a node.
+func NodeLogs(ctx context.Context, runtime runtimes.Runtime, nodes []*runtimes.Node, opts runtimes.LogsOptions, output func(node *runtimes.Node) (io.Writer, io.Writer)) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(nodes))
+
+	for i, node := range nodes {
+		wg.Add(1)
+
+		go func(i int, node *runtimes.Node) {
+			defer wg.Done()
+
+			stdout, stderr := output(node)
+
+			if err := runtime.Logs(ctx, node.Name, opts, stdout, stderr); err != nil {
+				errs[i] = fmt.Errorf("unable to read logs of %s: %w", node.Name, err)
+			}
+		}(i, node)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
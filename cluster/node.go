@@ -0,0 +1,248 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"n3d/constants"
+	"n3d/consul"
+	"n3d/loadbalancer"
+	"n3d/nomad"
+	"n3d/runtimes"
+	"n3d/state"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrorNodeNotFound     = errors.New("node not found")
+	ErrorNodeNotRemovable = errors.New("only nomad clients can be removed")
+	ErrorNodeCount        = errors.New("at least one node has to be added")
+)
+
+type NodeAddOptions struct {
+	Count      int
+	ExtraCerts []string
+}
+
+// NodeAdd adds nomad clients with the next free ids to a running cluster and
+// updates the load balancer so the exposed ports include them.
+func NodeAdd(ctx context.Context, cl *Cluster, runtime runtimes.Runtime, opts NodeAddOptions) (nodes []*runtimes.Node, err error) {
+	if opts.Count < 1 {
+		return nil, fmt.Errorf("%w, got %d", ErrorNodeCount, opts.Count)
+	}
+
+	if len(cl.Consul) == 0 || cl.Vault == nil || cl.Network == nil {
+		return nil, fmt.Errorf("cluster %s is incomplete, repair it with cluster create first", cl.Name())
+	}
+
+	st, err := state.LoadCluster(cl.Name())
+
+	if err != nil {
+		return nil, errors.Join(ErrorLoadState, err)
+	}
+
+	ca, err := ensureCA(cl.config, st)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tracker := newResourceTracker(runtime)
+	runtime = tracker
+
+	defer func() {
+		if err != nil {
+			log.WithContext(ctx).WithField("cluster-name", cl.Name()).Warn("adding nodes failed, rolling back.")
+			tracker.rollback()
+		}
+	}()
+
+	ids := freeIds(cl.Name(), cl.NomadClients, opts.Count)
+
+	// new clients run the version of the existing ones
+	version, image := resolveComponent(ctx, "nomad", "", "", nomad.DefaultVersion, cl.NomadClients)
+	if len(cl.NomadClients) == 0 {
+		version, _ = resolveComponent(ctx, "nomad", "", "", nomad.DefaultVersion, cl.NomadServers)
+	}
+
+	for _, id := range ids {
+		tls, err := issueCerts(ca, nomad.ClientName(cl.Name(), id), nomadClientName)
+
+		if err != nil {
+			return nil, errors.Join(ErrorProvisionNomadWorker, err)
+		}
+
+		w, err := nomad.NewNomadClient(ctx, runtime, nomad.NomadConfiguration{
+			NetworkName: cl.Network.Name,
+			ClusterName: cl.Name(),
+			ConsulAddr:  consul.Address(cl.Name()),
+			ConsulToken: st.ConsulNomadClientToken,
+			VaultAddr:   vaultAddr(ca, cl.Vault.Node.Name),
+			Id:          id,
+			ExtraCerts:  opts.ExtraCerts,
+			Docker:      cl.dockerConfig(),
+			Version:     version,
+			Image:       image,
+			ACL:         cl.NomadToken != "",
+			TLS:         tls,
+		})
+
+		if err != nil {
+			return nil, errors.Join(ErrorProvisionNomadWorker, err)
+		}
+
+		log.WithContext(ctx).WithField("name", w.Name).Info("nomad worker started.")
+
+		nodes = append(nodes, w)
+	}
+
+	cl.NomadClients = append(cl.NomadClients, nodes...)
+	sortNodes(cl.NomadClients)
+
+	if recordCount(&st.NomadWorkers, len(cl.NomadClients)) {
+		if err := state.SaveCluster(cl.Name(), st); err != nil {
+			return nil, errors.Join(ErrorSaveState, err)
+		}
+	}
+
+	if err := reloadLoadBalancer(ctx, runtime, cl); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// NodeRemove drains the nomad client, removes it with its volume and updates
+// the load balancer.
+func NodeRemove(ctx context.Context, cl *Cluster, runtime runtimes.Runtime, name string) error {
+	node := findNode(cl.Nodes(), name)
+
+	if node == nil {
+		return fmt.Errorf("%w: %s", ErrorNodeNotFound, name)
+	}
+
+	if node.Labels[constants.NodeType] != constants.NomadClient {
+		return fmt.Errorf("%w: %s is %s", ErrorNodeNotRemovable, name, node.Labels[constants.NodeType])
+	}
+
+	if node.IsRunning() {
+		if err := nomad.DrainNode(ctx, runtime, node, cl.NomadToken); err != nil {
+			return err
+		}
+
+		log.WithContext(ctx).WithField("name", name).Info("nomad worker drained.")
+	}
+
+	_ = runtime.StopNode(ctx, node)
+
+	if err := runtime.RemoveNode(ctx, node); err != nil {
+		return err
+	}
+
+	volumes, err := runtime.GetVolumesByLabel(ctx, map[string]string{
+		constants.ClusterName: cl.Name(),
+		constants.NodeName:    name,
+	})
+
+	if err != nil {
+		return fmt.Errorf("error listing node volumes %v", err)
+	}
+
+	if err := removeClusterVolumes(ctx, runtime, volumes); err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).WithField("name", name).Info("nomad worker removed.")
+
+	clients := make([]*runtimes.Node, 0, len(cl.NomadClients))
+	for _, c := range cl.NomadClients {
+		if c.Name != name {
+			clients = append(clients, c)
+		}
+	}
+
+	cl.NomadClients = clients
+
+	st, err := state.LoadCluster(cl.Name())
+
+	if err != nil {
+		return errors.Join(ErrorLoadState, err)
+	}
+
+	if recordCount(&st.NomadWorkers, len(cl.NomadClients)) {
+		if err := state.SaveCluster(cl.Name(), st); err != nil {
+			return errors.Join(ErrorSaveState, err)
+		}
+	}
+
+	return reloadLoadBalancer(ctx, runtime, cl)
+}
+
+// FindNode returns the node with the given name and the cluster it belongs to.
+func FindNode(ctx context.Context, runtime runtimes.Runtime, name string) (*Cluster, *runtimes.Node, error) {
+	clusters, err := ClusterList(ctx, runtime)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, cl := range clusters {
+		if n := findNode(cl.Nodes(), name); n != nil {
+			return cl, n, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("%w: %s", ErrorNodeNotFound, name)
+}
+
+func reloadLoadBalancer(ctx context.Context, runtime runtimes.Runtime, cl *Cluster) error {
+	if cl.LoadBalancer == nil {
+		log.WithContext(ctx).WithField("cluster-name", cl.Name()).Warn("cluster has no load balancer, skipping reload.")
+		return nil
+	}
+
+	if !cl.LoadBalancer.IsRunning() {
+		return fmt.Errorf("load balancer %s is not running", cl.LoadBalancer.Name)
+	}
+
+	if cl.Vault == nil {
+		return fmt.Errorf("%w: vault is missing, repair it with cluster create first", ErrorClusterIncomplete)
+	}
+
+	mappings := generatePortMappings(cl.exposedPorts(), nodeNames(cl.NomadServers), nodeNames(cl.Consul), cl.Vault.Node.Name, nodeNames(cl.NomadClients))
+
+	if err := loadbalancer.UpdateLoadBalancer(ctx, runtime, cl.LoadBalancer, mappings); err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).WithField("cluster-name", cl.Name()).Info("load balancer reloaded.")
+
+	return nil
+}
+
+// freeIds returns the lowest count ids which aren't used by the given nomad clients.
+func freeIds(clusterName string, clients []*runtimes.Node, count int) []int {
+	used := make(map[int]bool)
+	prefix := nomad.ClientName(clusterName, 0)
+	prefix = prefix[:len(prefix)-1]
+
+	for _, c := range clients {
+		id, err := strconv.Atoi(strings.TrimPrefix(c.Name, prefix))
+
+		if err == nil {
+			used[id] = true
+		}
+	}
+
+	ids := make([]int, 0, count)
+	for id := 0; len(ids) < count; id++ {
+		if !used[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
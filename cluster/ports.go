@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"n3d/constants"
+	"n3d/loadbalancer"
+	"n3d/runtimes"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	portOffsetStep     = 10
+	maxPortOffsetTries = 100
+)
+
+// selectPortOffset returns the offset added to every port the load balancer
+// publishes on the host. An existing load balancer keeps its offset, otherwise
+// the configured offset is used or the first offset whose ports are neither
+// reserved by another cluster nor in use on the host. Ports added to an existing
+// load balancer are checked with its offset.
+func selectPortOffset(ctx context.Context, runtime runtimes.Runtime, config ClusterConfig, existing *Cluster, ports []string) (int, error) {
+	reserved, err := reservedHostPorts(ctx, runtime, config.ClusterName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if existing.LoadBalancer != nil {
+		offset, err := strconv.Atoi(existing.LoadBalancer.Labels[constants.PortOffset])
+
+		if err == nil && (config.APIPortOffset == nil || *config.APIPortOffset == offset) {
+			// the published ports of the load balancer are in use by itself
+			added := make([]string, 0, len(ports))
+			for _, p := range ports {
+				if existing.LoadBalancer.Labels[constants.HostPortLabelPrefix+p] == "" {
+					added = append(added, p)
+				}
+			}
+
+			if port, ok := firstUnavailablePort(added, offset, reserved); !ok {
+				return 0, fmt.Errorf("host port %d is already in use, remove the port or choose another --api-port-offset", port)
+			}
+
+			return offset, nil
+		}
+	}
+
+	ports = append([]string{NomadPort, ConsulPort, VaultPort}, ports...)
+
+	if config.APIPortOffset != nil {
+		if port, ok := firstUnavailablePort(ports, *config.APIPortOffset, reserved); !ok {
+			return 0, fmt.Errorf("host port %d is already in use, choose another --api-port-offset", port)
+		}
+
+		return *config.APIPortOffset, nil
+	}
+
+	for i := 0; i < maxPortOffsetTries; i++ {
+		offset := i * portOffsetStep
+
+		if _, ok := firstUnavailablePort(ports, offset, reserved); ok {
+			return offset, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unable to find free host ports for the load balancer")
+}
+
+// reservedHostPorts returns the host ports recorded on the load balancers of
+// the other clusters, stopped clusters keep their ports reserved.
+func reservedHostPorts(ctx context.Context, runtime runtimes.Runtime, clusterName string) (map[string]bool, error) {
+	lbs, err := runtime.GetNodesByLabel(ctx, map[string]string{
+		constants.NodeType: constants.LoadBalancer,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to list load balancers: %w", err)
+	}
+
+	reserved := make(map[string]bool)
+
+	for _, lb := range lbs {
+		if lb.Labels[constants.ClusterName] == clusterName {
+			continue
+		}
+
+		for k, v := range lb.Labels {
+			if strings.HasPrefix(k, constants.HostPortLabelPrefix) {
+				reserved[v] = true
+			}
+		}
+	}
+
+	return reserved, nil
+}
+
+func firstUnavailablePort(ports []string, offset int, reserved map[string]bool) (int, bool) {
+	for _, p := range ports {
+		port, err := strconv.Atoi(p)
+
+		if err != nil {
+			continue
+		}
+
+		hostPort := port + offset
+
+		if hostPort > 65535 || reserved[strconv.Itoa(hostPort)] || !portFree(hostPort) {
+			return hostPort, false
+		}
+	}
+
+	return 0, true
+}
+
+// portFree probes the host, tests replace it.
+var portFree = isPortFree
+
+func isPortFree(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+
+	if err != nil {
+		return false
+	}
+
+	_ = l.Close()
+
+	return true
+}
+
+// applyPortOffset sets the host ports of the mappings and returns the labels recording them.
+func applyPortOffset(mappings []*loadbalancer.PortMapping, offset int) map[string]string {
+	labels := map[string]string{
+		constants.PortOffset: strconv.Itoa(offset),
+	}
+
+	for _, m := range mappings {
+		port, err := strconv.Atoi(m.Port.Port())
+
+		if err != nil {
+			continue
+		}
+
+		m.HostPort = strconv.Itoa(port + offset)
+		labels[constants.HostPortLabelPrefix+m.Port.Port()] = m.HostPort
+	}
+
+	return labels
+}
@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"context"
+	"n3d/constants"
+	"n3d/runtimes"
+	"testing"
+)
+
+// lbRuntime returns the given load balancers, the port offset selection
+// doesn't use the rest of the runtime.
+type lbRuntime struct {
+	runtimes.Runtime
+	lbs []*runtimes.Node
+}
+
+func (r *lbRuntime) GetNodesByLabel(ctx context.Context, labels map[string]string) ([]*runtimes.Node, error) {
+	return r.lbs, nil
+}
+
+func loadBalancer(clusterName string, labels map[string]string) *runtimes.Node {
+	node := &runtimes.Node{
+		Name: clusterName + "-default-lb",
+		Labels: map[string]string{
+			constants.ClusterName: clusterName,
+			constants.NodeType:    constants.LoadBalancer,
+		},
+	}
+
+	for k, v := range labels {
+		node.Labels[k] = v
+	}
+
+	return node
+}
+
+// stubPortFree makes the given host ports look in use for the test.
+func stubPortFree(t *testing.T, used ...int) {
+	t.Helper()
+
+	portFree = func(port int) bool {
+		for _, u := range used {
+			if u == port {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	t.Cleanup(func() { portFree = isPortFree })
+}
+
+func TestSelectPortOffset(t *testing.T) {
+	offset := func(v int) *int { return &v }
+
+	tests := []struct {
+		name     string
+		config   ClusterConfig
+		existing *Cluster
+		lbs      []*runtimes.Node
+		// ports to expose, defaults to 8080
+		ports []string
+		// used are the host ports in use by other processes
+		used    []int
+		want    int
+		wantErr bool
+	}{
+		{
+			name:     "first free offset",
+			config:   ClusterConfig{ClusterName: "c"},
+			existing: &Cluster{},
+			want:     0,
+		},
+		{
+			name:     "existing load balancer keeps its offset",
+			config:   ClusterConfig{ClusterName: "c"},
+			existing: &Cluster{LoadBalancer: loadBalancer("c", map[string]string{constants.PortOffset: "30"})},
+			want:     30,
+		},
+		{
+			name:   "existing load balancer with an added port",
+			config: ClusterConfig{ClusterName: "c"},
+			existing: &Cluster{LoadBalancer: loadBalancer("c", map[string]string{
+				constants.PortOffset:                   "30",
+				constants.HostPortLabelPrefix + "8080": "8110",
+			})},
+			ports: []string{"8080", "9090"},
+			used:  []int{8110},
+			want:  30,
+		},
+		{
+			name:   "existing load balancer with an added port in use",
+			config: ClusterConfig{ClusterName: "c"},
+			existing: &Cluster{LoadBalancer: loadBalancer("c", map[string]string{
+				constants.PortOffset:                   "30",
+				constants.HostPortLabelPrefix + "8080": "8110",
+			})},
+			ports:   []string{"8080", "9090"},
+			used:    []int{8110, 9120},
+			wantErr: true,
+		},
+		{
+			name:   "existing load balancer with an added port reserved",
+			config: ClusterConfig{ClusterName: "c"},
+			existing: &Cluster{LoadBalancer: loadBalancer("c", map[string]string{
+				constants.PortOffset: "30",
+			})},
+			lbs:     []*runtimes.Node{loadBalancer("a", map[string]string{constants.HostPortLabelPrefix + "8080": "8110"})},
+			ports:   []string{"8080"},
+			wantErr: true,
+		},
+		{
+			name:     "configured offset replaces the existing one",
+			config:   ClusterConfig{ClusterName: "c", APIPortOffset: offset(40)},
+			existing: &Cluster{LoadBalancer: loadBalancer("c", map[string]string{constants.PortOffset: "30"})},
+			want:     40,
+		},
+		{
+			name:     "ports reserved by another cluster",
+			config:   ClusterConfig{ClusterName: "c"},
+			existing: &Cluster{},
+			lbs: []*runtimes.Node{
+				loadBalancer("a", map[string]string{constants.HostPortLabelPrefix + "4646": "4646"}),
+				loadBalancer("b", map[string]string{constants.HostPortLabelPrefix + "8500": "8510"}),
+			},
+			want: 20,
+		},
+		{
+			name:     "own ports aren't reserved",
+			config:   ClusterConfig{ClusterName: "c"},
+			existing: &Cluster{},
+			lbs:      []*runtimes.Node{loadBalancer("c", map[string]string{constants.HostPortLabelPrefix + "4646": "4646"})},
+			want:     0,
+		},
+		{
+			name:     "exposed ports are checked",
+			config:   ClusterConfig{ClusterName: "c"},
+			existing: &Cluster{},
+			lbs:      []*runtimes.Node{loadBalancer("a", map[string]string{constants.HostPortLabelPrefix + "8080": "8080"})},
+			want:     10,
+		},
+		{
+			name:     "host ports in use",
+			config:   ClusterConfig{ClusterName: "c"},
+			existing: &Cluster{},
+			used:     []int{8500, 8090},
+			want:     20,
+		},
+		{
+			name:     "configured offset in use",
+			config:   ClusterConfig{ClusterName: "c", APIPortOffset: offset(10)},
+			existing: &Cluster{},
+			used:     []int{4656},
+			wantErr:  true,
+		},
+		{
+			name:     "configured offset is reserved",
+			config:   ClusterConfig{ClusterName: "c", APIPortOffset: offset(10)},
+			existing: &Cluster{},
+			lbs:      []*runtimes.Node{loadBalancer("a", map[string]string{constants.HostPortLabelPrefix + "8200": "8210"})},
+			wantErr:  true,
+		},
+		{
+			name:     "configured offset beyond the port range",
+			config:   ClusterConfig{ClusterName: "c", APIPortOffset: offset(65000)},
+			existing: &Cluster{},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPortFree(t, tt.used...)
+
+			ports := tt.ports
+			if ports == nil {
+				ports = []string{"8080"}
+			}
+
+			got, err := selectPortOffset(context.Background(), &lbRuntime{lbs: tt.lbs}, tt.config, tt.existing, ports)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectPortOffset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("selectPortOffset() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
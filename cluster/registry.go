@@ -0,0 +1,139 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"n3d/nomad"
+	"n3d/registry"
+	"n3d/runtimes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrorProvisionRegistry = errors.New("unable to provision registry")
+	ErrorRegistryExists    = errors.New("cluster already has a registry")
+)
+
+// RegistryCreate adds a registry to an existing cluster and makes the docker
+// daemons of its nomad clients trust it.
+func RegistryCreate(ctx context.Context, cl *Cluster, runtime runtimes.Runtime, port int) (node *runtimes.Node, err error) {
+	if cl.Registry != nil {
+		return nil, fmt.Errorf("%w: %s", ErrorRegistryExists, cl.Registry.Name)
+	}
+
+	if cl.Network == nil {
+		return nil, fmt.Errorf("cluster %s is incomplete, repair it with cluster create first", cl.Name())
+	}
+
+	tracker := newResourceTracker(runtime)
+	runtime = tracker
+
+	defer func() {
+		if err != nil {
+			log.WithContext(ctx).WithField("cluster-name", cl.Name()).Warn("creating registry failed, rolling back.")
+			tracker.rollback()
+		}
+	}()
+
+	node, err = newRegistry(ctx, runtime, cl.Name(), cl.Network.Name, port)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cl.Registry = node
+
+	if err := configureWorkersDocker(ctx, runtime, cl.NomadClients, cl.dockerConfig()); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+func newRegistry(ctx context.Context, runtime runtimes.Runtime, clusterName string, networkName string, port int) (*runtimes.Node, error) {
+	if port == 0 {
+		port = registry.DefaultPort
+	}
+
+	if !isPortFree(port) {
+		return nil, fmt.Errorf("%w: host port %d is not available", ErrorProvisionRegistry, port)
+	}
+
+	node, err := registry.NewRegistry(ctx, runtime, registry.RegistryConfiguration{
+		ClusterName: clusterName,
+		NetworkName: networkName,
+		Port:        port,
+	})
+
+	if err != nil {
+		return nil, errors.Join(ErrorProvisionRegistry, err)
+	}
+
+	log.WithContext(ctx).WithField("address", registry.Address(node)).Info("registry started.")
+
+	return node, nil
+}
+
+func newRegistryMirror(ctx context.Context, runtime runtimes.Runtime, clusterName string, networkName string, remoteURL string) (*runtimes.Node, error) {
+	node, err := registry.NewMirror(ctx, runtime, registry.MirrorConfiguration{
+		ClusterName: clusterName,
+		NetworkName: networkName,
+		RemoteURL:   remoteURL,
+	})
+
+	if err != nil {
+		return nil, errors.Join(ErrorProvisionRegistry, err)
+	}
+
+	log.WithContext(ctx).WithField("url", registry.MirrorURL(node)).Info("registry mirror started.")
+
+	return node, nil
+}
+
+// configureWorkersDocker merges the docker settings into the daemon.json of the nomad clients.
+func configureWorkersDocker(ctx context.Context, runtime runtimes.Runtime, workers []*runtimes.Node, docker nomad.DockerDaemonConfig) error {
+	for _, w := range workers {
+		if err := nomad.ConfigureDocker(ctx, runtime, w, docker); err != nil {
+			return err
+		}
+
+		log.WithContext(ctx).WithField("name", w.Name).Info("nomad worker docker configured.")
+	}
+
+	return nil
+}
+
+// forwardLocalRegistry makes localhost of the workers reach the registry
+// again, the forwarding is lost when a worker restarts.
+func forwardLocalRegistry(ctx context.Context, runtime runtimes.Runtime, cl *Cluster, workers []*runtimes.Node) error {
+	if cl.Registry == nil {
+		return nil
+	}
+
+	for _, w := range workers {
+		if err := nomad.ForwardLocalRegistry(ctx, runtime, w, registry.Address(cl.Registry)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dockerConfig returns the docker daemon settings the nomad clients of the cluster need.
+func (c *Cluster) dockerConfig() nomad.DockerDaemonConfig {
+	docker := nomad.DockerDaemonConfig{}
+
+	if c.Registry != nil {
+		docker.InsecureRegistries = append(docker.InsecureRegistries, registry.Address(c.Registry))
+		docker.LocalRegistry = registry.Address(c.Registry)
+	}
+
+	if c.RegistryMirror != nil {
+		docker.InsecureRegistries = append(docker.InsecureRegistries, registry.MirrorAddress(c.RegistryMirror))
+		docker.RegistryMirrors = append(docker.RegistryMirrors, registry.MirrorURL(c.RegistryMirror))
+	}
+
+	return docker
+}
@@ -0,0 +1,153 @@
+package cluster
+
+import (
+	"context"
+	"n3d/runtimes"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const rollbackTimeout = time.Minute * 2
+
+type resourceKind int
+
+const (
+	networkResource resourceKind = iota
+	volumeResource
+	nodeResource
+	removedResource
+)
+
+type resource struct {
+	kind resourceKind
+	name string
+	node *runtimes.Node
+	// restore recreates a resource removed while creating the cluster.
+	restore func(ctx context.Context, runtime runtimes.Runtime) error
+}
+
+// resourceTracker records every resource created through the runtime,
+// so a failed cluster creation can be rolled back.
+type resourceTracker struct {
+	runtimes.Runtime
+
+	mu        sync.Mutex
+	resources []resource
+}
+
+func newResourceTracker(runtime runtimes.Runtime) *resourceTracker {
+	return &resourceTracker{
+		Runtime: runtime,
+	}
+}
+
+// CreateNetwork only tracks the network when it didn't exist before, since
+// creating an existing network is a no-op.
+func (t *resourceTracker) CreateNetwork(ctx context.Context, name string, labels map[string]string) error {
+	networks, err := t.Runtime.GetNetworksByLabel(ctx, labels)
+
+	if err != nil {
+		return err
+	}
+
+	for _, n := range networks {
+		if n.Name == name {
+			return nil
+		}
+	}
+
+	err = t.Runtime.CreateNetwork(ctx, name, labels)
+
+	if err == nil {
+		t.track(resource{kind: networkResource, name: name})
+	}
+
+	return err
+}
+
+// CreateVolume only tracks the volume when it didn't exist before, so a failed
+// repair never removes the data of an existing cluster.
+func (t *resourceTracker) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	volumes, err := t.Runtime.GetVolumesByLabel(ctx, labels)
+
+	if err != nil {
+		return err
+	}
+
+	for _, v := range volumes {
+		if v.Name == name {
+			return nil
+		}
+	}
+
+	err = t.Runtime.CreateVolume(ctx, name, labels)
+
+	if err == nil {
+		t.track(resource{kind: volumeResource, name: name})
+	}
+
+	return err
+}
+
+func (t *resourceTracker) RunNode(ctx context.Context, config runtimes.NodeConfig) (*runtimes.Node, error) {
+	node, err := t.Runtime.RunNode(ctx, config)
+
+	if err == nil {
+		t.track(resource{kind: nodeResource, name: node.Name, node: node})
+	}
+
+	return node, err
+}
+
+// trackRemoved records a resource which was removed to be replaced, restore
+// recreates it on rollback.
+func (t *resourceTracker) trackRemoved(name string, restore func(ctx context.Context, runtime runtimes.Runtime) error) {
+	t.track(resource{kind: removedResource, name: name, restore: restore})
+}
+
+func (t *resourceTracker) track(r resource) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.resources = append(t.resources, r)
+}
+
+// rollback removes the tracked resources in reverse order of their creation.
+// It doesn't use the creation context since it is likely cancelled at this point.
+func (t *resourceTracker) rollback() {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.resources) - 1; i >= 0; i-- {
+		r := t.resources[i]
+		logger := log.WithContext(ctx).WithField("name", r.name)
+
+		var err error
+
+		switch r.kind {
+		case nodeResource:
+			_ = t.Runtime.StopNode(ctx, r.node)
+			err = t.Runtime.RemoveNode(ctx, r.node)
+		case volumeResource:
+			err = t.Runtime.RemoveVolume(ctx, r.name)
+		case networkResource:
+			err = t.Runtime.DeleteNetwork(ctx, r.name)
+		case removedResource:
+			err = r.restore(ctx, t.Runtime)
+		}
+
+		if err != nil {
+			logger.WithError(err).Warn("unable to roll back resource")
+			continue
+		}
+
+		logger.Info("rolled back.")
+	}
+
+	t.resources = nil
+}
@@ -0,0 +1,253 @@
+package cluster
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"n3d/consul"
+	"n3d/nomad"
+	"n3d/runtimes"
+	"n3d/state"
+	"n3d/vault"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	snapshotVersion      = 1
+	snapshotManifestFile = "manifest.json"
+	snapshotNomadFile    = "nomad.snap"
+	snapshotConsulFile   = "consul.snap"
+	snapshotStateFile    = "state.json"
+)
+
+var ErrorSnapshotTopology = errors.New("snapshot topology doesn't match the cluster")
+
+type snapshotManifest struct {
+	Version       int       `json:"version"`
+	ClusterName   string    `json:"clusterName"`
+	Created       time.Time `json:"created"`
+	NomadServers  int       `json:"nomadServers"`
+	NomadClients  int       `json:"nomadClients"`
+	ConsulServers int       `json:"consulServers"`
+}
+
+// SnapshotSave writes an archive with the nomad and consul snapshots and the
+// vault keys, vault data itself is part of the consul snapshot.
+func SnapshotSave(ctx context.Context, d *Cluster, runtime runtimes.Runtime, w io.Writer) error {
+	if len(d.Consul) == 0 || d.Vault == nil || len(d.NomadServers) == 0 {
+		return ErrorClusterIncomplete
+	}
+
+	nomadSnapshot, err := nomad.SnapshotSave(ctx, runtime, d.NomadServers[0], d.NomadToken)
+
+	if err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("saved nomad snapshot.")
+
+	consulSnapshot, err := consul.SnapshotSave(ctx, runtime, d.Consul[0], d.ConsulToken)
+
+	if err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("saved consul snapshot.")
+
+	st, err := state.LoadCluster(d.config.ClusterName)
+
+	if err != nil {
+		return errors.Join(ErrorLoadState, err)
+	}
+
+	manifest, err := json.MarshalIndent(&snapshotManifest{
+		Version:       snapshotVersion,
+		ClusterName:   d.config.ClusterName,
+		Created:       time.Now().UTC(),
+		NomadServers:  len(d.NomadServers),
+		NomadClients:  len(d.NomadClients),
+		ConsulServers: len(d.Consul),
+	}, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	stateContent, err := json.Marshal(st)
+
+	if err != nil {
+		return err
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{snapshotManifestFile, manifest},
+		{snapshotNomadFile, nomadSnapshot},
+		{snapshotConsulFile, consulSnapshot},
+		{snapshotStateFile, stateContent},
+	}
+
+	for _, f := range files {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:    f.name,
+			Mode:    0600,
+			Size:    int64(len(f.content)),
+			ModTime: time.Now(),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to write snapshot archive: %w", err)
+		}
+
+		if _, err := tarWriter.Write(f.content); err != nil {
+			return fmt.Errorf("failed to write snapshot archive: %w", err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot archive: %w", err)
+	}
+
+	return gzipWriter.Close()
+}
+
+// SnapshotRestore replays a snapshot archive into a running cluster of the
+// same topology, vault is restarted and unsealed with the keys of the archive.
+func SnapshotRestore(ctx context.Context, d *Cluster, runtime runtimes.Runtime, r io.Reader) error {
+	if len(d.Consul) == 0 || d.Vault == nil || len(d.NomadServers) == 0 {
+		return ErrorClusterIncomplete
+	}
+
+	files, err := readSnapshotArchive(r)
+
+	if err != nil {
+		return err
+	}
+
+	manifest := &snapshotManifest{}
+	if err := json.Unmarshal(files[snapshotManifestFile], manifest); err != nil {
+		return fmt.Errorf("unable to parse snapshot manifest: %w", err)
+	}
+
+	if manifest.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", manifest.Version)
+	}
+
+	if manifest.NomadServers != len(d.NomadServers) || manifest.NomadClients != len(d.NomadClients) || manifest.ConsulServers != len(d.Consul) {
+		return fmt.Errorf("%w: snapshot has %d nomad servers, %d nomad clients and %d consul servers, cluster has %d, %d and %d",
+			ErrorSnapshotTopology,
+			manifest.NomadServers, manifest.NomadClients, manifest.ConsulServers,
+			len(d.NomadServers), len(d.NomadClients), len(d.Consul))
+	}
+
+	st := &state.ClusterState{}
+	if err := json.Unmarshal(files[snapshotStateFile], st); err != nil {
+		return fmt.Errorf("unable to parse snapshot state: %w", err)
+	}
+
+	if err := consul.SnapshotRestore(ctx, runtime, d.Consul[0], d.ConsulToken, files[snapshotConsulFile]); err != nil {
+		return err
+	}
+
+	d.ConsulToken = st.ConsulManagementToken
+
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("restored consul snapshot.")
+
+	if st.VaultRootToken != d.Vault.RootToken {
+		log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Warn("snapshot was taken from another vault, nomad keeps using the current vault token.")
+	}
+
+	_ = runtime.StopNode(ctx, d.Vault.Node)
+
+	if err := runtime.StartNode(ctx, d.Vault.Node); err != nil {
+		return errors.Join(ErrorProvisionVault, err)
+	}
+
+	d.Vault.UnsealKey = st.VaultUnsealKey
+	d.Vault.RootToken = st.VaultRootToken
+
+	if err := vault.Unseal(ctx, runtime, d.Vault, d.config.readyTimeout()); err != nil {
+		return errors.Join(ErrorProvisionVault, err)
+	}
+
+	current, err := state.LoadCluster(d.config.ClusterName)
+
+	if err != nil {
+		return errors.Join(ErrorLoadState, err)
+	}
+
+	// the nodes keep using the certificates of the current CA and their gossip keys
+	st.TLSCACert, st.TLSCAKey = current.TLSCACert, current.TLSCAKey
+	st.ConsulGossipKey, st.NomadGossipKey = current.ConsulGossipKey, current.NomadGossipKey
+	// the restore doesn't change the nodes of the cluster
+	st.NomadServers, st.NomadWorkers, st.ConsulServers = current.NomadServers, current.NomadWorkers, current.ConsulServers
+
+	if err := state.SaveCluster(d.config.ClusterName, st); err != nil {
+		return errors.Join(ErrorSaveState, err)
+	}
+
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("restored vault.")
+
+	if err := nomad.SnapshotRestore(ctx, runtime, d.NomadServers[0], d.NomadToken, files[snapshotNomadFile]); err != nil {
+		return err
+	}
+
+	// the acl tokens are part of the restored raft state
+	d.NomadToken = st.NomadACLToken
+
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("restored nomad snapshot.")
+
+	return ClusterWait(ctx, d, runtime, d.config.readyTimeout())
+}
+
+func readSnapshotArchive(r io.Reader) (map[string][]byte, error) {
+	gzipReader, err := gzip.NewReader(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot archive: %w", err)
+	}
+
+	defer gzipReader.Close()
+
+	files := make(map[string][]byte)
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read snapshot archive: %w", err)
+		}
+
+		content, err := io.ReadAll(tarReader)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read snapshot archive: %w", err)
+		}
+
+		files[header.Name] = content
+	}
+
+	for _, name := range []string{snapshotManifestFile, snapshotNomadFile, snapshotConsulFile, snapshotStateFile} {
+		if _, ok := files[name]; !ok {
+			return nil, fmt.Errorf("snapshot archive is missing %s", name)
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,67 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"n3d/certs"
+	"n3d/state"
+)
+
+var ErrorTLSExistingCluster = errors.New("tls can't be enabled on an existing cluster")
+
+// ensureCA loads the CA of the cluster from the state, or creates it when
+// tls is requested. It returns nil when tls is disabled.
+func ensureCA(config ClusterConfig, st *state.ClusterState) (*certs.CA, error) {
+	if st.TLSCACert != "" {
+		return certs.LoadCA([]byte(st.TLSCACert), []byte(st.TLSCAKey))
+	}
+
+	if !config.TLS {
+		return nil, nil
+	}
+
+	ca, err := certs.NewCA(config.ClusterName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	st.TLSCACert = string(ca.CertPEM)
+	st.TLSCAKey = string(ca.KeyPEM)
+
+	if err := state.SaveCluster(config.ClusterName, st); err != nil {
+		return nil, errors.Join(ErrorSaveState, err)
+	}
+
+	if err := state.SaveCA(config.ClusterName, ca.CertPEM); err != nil {
+		return nil, errors.Join(ErrorSaveState, err)
+	}
+
+	return ca, nil
+}
+
+// issueCerts issues the certificate of a node, it returns nil when tls is disabled.
+func issueCerts(ca *certs.CA, nodeName string, dnsNames ...string) (*certs.NodeCerts, error) {
+	if ca == nil {
+		return nil, nil
+	}
+
+	return ca.Issue(nodeName, dnsNames...)
+}
+
+// vaultAddr returns the address nomad reaches vault on.
+func vaultAddr(ca *certs.CA, nodeName string) string {
+	scheme := "http"
+	if ca != nil {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s:8200", scheme, nodeName)
+}
+
+// Names the certificates of the servers have to include, the agents verify them.
+const (
+	consulServerName = "server.dc1.consul"
+	nomadServerName  = "server.global.nomad"
+	nomadClientName  = "client.global.nomad"
+)
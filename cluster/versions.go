@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"context"
+	"n3d/constants"
+	"n3d/consul"
+	"n3d/nomad"
+	"n3d/runtimes"
+	"n3d/vault"
+	"n3d/versions"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Images override the images derived from the component versions.
+type Images struct {
+	NomadServer  string
+	NomadClient  string
+	Consul       string
+	Vault        string
+	LoadBalancer string
+}
+
+// componentImages holds the resolved version and image of every component,
+// an empty image means the image of the version.
+type componentImages struct {
+	versions versions.Versions
+	images   Images
+}
+
+// resolveImages picks the versions and images of the nodes to create, explicit
+// values come first, then the ones of the existing nodes and the defaults last.
+func resolveImages(ctx context.Context, config ClusterConfig, existing *Cluster) (*componentImages, error) {
+	var vaultNodes []*runtimes.Node
+	if existing.Vault != nil {
+		vaultNodes = []*runtimes.Node{existing.Vault.Node}
+	}
+
+	var lbNodes []*runtimes.Node
+	if existing.LoadBalancer != nil {
+		lbNodes = []*runtimes.Node{existing.LoadBalancer}
+	}
+
+	resolved := &componentImages{}
+
+	resolved.versions.Nomad, resolved.images.NomadServer = resolveComponent(ctx, "nomad", config.Versions.Nomad, config.Images.NomadServer, nomad.DefaultVersion, existing.NomadServers)
+	_, resolved.images.NomadClient = resolveComponent(ctx, "nomad", config.Versions.Nomad, config.Images.NomadClient, nomad.DefaultVersion, existing.NomadClients)
+	resolved.versions.Consul, resolved.images.Consul = resolveComponent(ctx, "consul", config.Versions.Consul, config.Images.Consul, consul.DefaultVersion, existing.Consul)
+	resolved.versions.Vault, resolved.images.Vault = resolveComponent(ctx, "vault", config.Versions.Vault, config.Images.Vault, vault.DefaultVersion, vaultNodes)
+	_, resolved.images.LoadBalancer = resolveComponent(ctx, "load balancer", "", config.Images.LoadBalancer, "", lbNodes)
+
+	if err := versions.Check(resolved.versions); err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+func resolveComponent(ctx context.Context, component string, version string, image string, defaultVersion string, nodes []*runtimes.Node) (string, string) {
+	if version == "" && image == "" {
+		if len(nodes) > 0 {
+			return nodes[0].Labels[constants.Version], nodes[0].Labels[constants.Image]
+		}
+
+		return defaultVersion, ""
+	}
+
+	if version == "" {
+		version = versions.TagOf(image)
+	}
+
+	for _, n := range nodes {
+		if n.Labels[constants.Version] != version || (image != "" && n.Labels[constants.Image] != image) {
+			log.WithContext(ctx).WithFields(log.Fields{
+				"name":    n.Name,
+				"version": n.Labels[constants.Version],
+			}).Warnf("existing %s node isn't upgraded, only new nodes use the requested version.", component)
+		}
+	}
+
+	return version, image
+}
+
+// Versions returns the component versions recorded on the nodes.
+func (c *Cluster) Versions() versions.Versions {
+	v := versions.Versions{}
+
+	if len(c.NomadServers) > 0 {
+		v.Nomad = c.NomadServers[0].Labels[constants.Version]
+	}
+
+	if len(c.Consul) > 0 {
+		v.Consul = c.Consul[0].Labels[constants.Version]
+	}
+
+	if c.Vault != nil {
+		v.Vault = c.Vault.Node.Labels[constants.Version]
+	}
+
+	return v
+}
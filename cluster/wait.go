@@ -0,0 +1,49 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"n3d/consul"
+	"n3d/nomad"
+	"n3d/runtimes"
+	"n3d/vault"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrorClusterIncomplete = errors.New("cluster is incomplete")
+
+// ClusterWait waits until consul and nomad have a leader, vault is unsealed and
+// every nomad client is registered as ready.
+func ClusterWait(ctx context.Context, d *Cluster, runtime runtimes.Runtime, timeout time.Duration) error {
+	if len(d.Consul) == 0 || d.Vault == nil || len(d.NomadServers) == 0 {
+		return ErrorClusterIncomplete
+	}
+
+	if err := consul.WaitForLeader(ctx, runtime, d.Consul[0], timeout); err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("consul has a leader.")
+
+	if err := vault.WaitForUnsealed(ctx, runtime, d.Vault.Node, timeout); err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("vault is unsealed.")
+
+	if err := nomad.WaitForLeader(ctx, runtime, d.NomadServers[0], timeout); err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("nomad has a leader.")
+
+	if err := nomad.WaitForClients(ctx, runtime, d.NomadServers[0], d.NomadToken, len(d.NomadClients), timeout); err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).WithField("cluster-name", d.config.ClusterName).Info("nomad workers are ready.")
+
+	return nil
+}
@@ -1,16 +1,46 @@
 package cluster
 
 import (
+	"errors"
 	"n3d/cluster"
+	"n3d/cmd/util"
+	"n3d/consul"
+	"n3d/loadbalancer"
+	"n3d/nomad"
+	"n3d/registry"
 	"n3d/runtimes"
+	"n3d/state"
+	"n3d/vault"
+	"n3d/versions"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var serverCount int
 var workerCount int
+var consulServerCount int
 var extraCerts []string
 var portsToExpose []string
+var configFile string
+var keepOnFailure bool
+var readyTimeout time.Duration
+var apiPortOffset int
+var withRegistry bool
+var registryPort int
+var withRegistryMirror bool
+var registryMirrorRemote string
+var keepRegistryCache bool
+var versionFlags versions.Versions
+var imageFlags cluster.Images
+var nomadACL bool
+var consulACL bool
+var withTLS bool
+var workloadIdentity bool
 
 func NewClusterCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -24,30 +54,23 @@ func NewClusterCommand() *cobra.Command {
 	}
 
 	addCmd := &cobra.Command{
-		Use:  "create NAME",
-		Args: cobra.RangeArgs(0, 1),
+		Use:     "create NAME",
+		Aliases: []string{"repair"},
+		Args:    cobra.RangeArgs(0, 1),
 		Run: func(cmd *cobra.Command, args []string) {
 			runtime := runtimes.SelectedRuntime
 
-			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
-				ClusterName: args[0],
-			})
+			config, err := createConfig(cmd, args)
 
 			if err != nil {
-				log.WithError(err).Error("unable to fetch cluster")
-			}
-
-			if cl != nil {
-				log.Info("cluster already exist")
+				log.WithError(err).Error("invalid cluster configuration")
 				return
 			}
 
-			err = cluster.ClusterCreate(cmd.Context(), cluster.ClusterConfig{
-				ClusterName:   args[0],
-				WorkerCount:   workerCount,
-				ExtraCerts:    extraCerts,
-				PortsToExpose: portsToExpose,
-			}, runtime)
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			err = cluster.ClusterCreate(ctx, *config, runtime)
 
 			if err != nil {
 				log.WithError(err).Error("unable to create cluster")
@@ -61,8 +84,15 @@ func NewClusterCommand() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			runtime := runtimes.SelectedRuntime
 
+			clusterName, err := util.ClusterName(args)
+
+			if err != nil {
+				log.WithError(err).Error("unable to delete cluster")
+				return
+			}
+
 			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
-				ClusterName: args[0],
+				ClusterName: clusterName,
 			})
 
 			if err != nil {
@@ -75,10 +105,17 @@ func NewClusterCommand() *cobra.Command {
 				return
 			}
 
-			err = cluster.ClusterDelete(cmd.Context(), cl, runtime)
+			err = cluster.ClusterDelete(cmd.Context(), cl, runtime, cluster.ClusterDeleteOptions{
+				KeepRegistryCache: keepRegistryCache,
+			})
 
 			if err != nil {
 				log.WithError(err).Error("unable to delete cluster")
+				return
+			}
+
+			if err := clearContext(clusterName); err != nil {
+				log.WithError(err).Warn("unable to clear current context")
 			}
 		},
 	}
@@ -89,8 +126,15 @@ func NewClusterCommand() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			runtime := runtimes.SelectedRuntime
 
+			clusterName, err := util.ClusterName(args)
+
+			if err != nil {
+				log.WithError(err).Error("unable to stop cluster")
+				return
+			}
+
 			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
-				ClusterName: args[0],
+				ClusterName: clusterName,
 			})
 
 			if err != nil {
@@ -117,12 +161,19 @@ func NewClusterCommand() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			runtime := runtimes.SelectedRuntime
 
+			clusterName, err := util.ClusterName(args)
+
+			if err != nil {
+				log.WithError(err).Error("unable to start cluster")
+				return
+			}
+
 			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
-				ClusterName: args[0],
+				ClusterName: clusterName,
 			})
 
 			if err != nil {
-				log.WithError(err).Error("unable to stop cluster")
+				log.WithError(err).Error("unable to start cluster")
 				return
 			}
 
@@ -134,16 +185,202 @@ func NewClusterCommand() *cobra.Command {
 			err = cluster.ClusterStart(cmd.Context(), cl, runtime)
 
 			if err != nil {
-				log.WithError(err).Error("unable to stop cluster")
+				log.WithError(err).Error("unable to start cluster")
 			}
 		},
 	}
 
+	addCmd.Flags().IntVar(&serverCount, "servers", 1, "Nomad servers count, use 3 or 5 for a highly available quorum")
 	addCmd.Flags().IntVarP(&workerCount, "worker-count", "w", 1, "Nomad workers count")
+	addCmd.Flags().IntVar(&consulServerCount, "consul-servers", 1, "Consul servers count, use 3 to survive a leader loss")
 	addCmd.Flags().StringArrayVar(&extraCerts, "extra-certs", []string{}, "Extra certs to put in container")
 	addCmd.Flags().StringArrayVar(&portsToExpose, "ports", []string{}, "Ports to expose")
+	addCmd.Flags().BoolVar(&keepOnFailure, "keep-on-failure", false, "Keep created resources when the cluster creation fails, for debugging")
+	addCmd.Flags().IntVar(&apiPortOffset, "api-port-offset", 0, "Offset added to the host ports of the load balancer, a free offset is allocated when omitted")
+	addCmd.Flags().DurationVar(&readyTimeout, "timeout", cluster.DefaultReadyTimeout, "Time to wait for every component to become ready")
+	addCmd.Flags().BoolVar(&withRegistry, "registry", false, "Run a docker registry the nomad workers can pull from")
+	addCmd.Flags().IntVar(&registryPort, "registry-port", registry.DefaultPort, "Host port of the registry")
+	addCmd.Flags().BoolVar(&withRegistryMirror, "registry-mirror", false, "Run a pull through cache the nomad workers pull images through")
+	addCmd.Flags().StringVar(&registryMirrorRemote, "registry-mirror-remote", registry.DefaultRemoteURL, "Registry the mirror caches")
+	addCmd.Flags().StringVar(&versionFlags.Nomad, "nomad-version", "", "Nomad version, defaults to "+nomad.DefaultVersion)
+	addCmd.Flags().StringVar(&versionFlags.Consul, "consul-version", "", "Consul version, defaults to "+consul.DefaultVersion)
+	addCmd.Flags().StringVar(&versionFlags.Vault, "vault-version", "", "Vault version, defaults to "+vault.DefaultVersion)
+	addCmd.Flags().StringVar(&imageFlags.NomadServer, "nomad-server-image", "", "Nomad server image, overrides the image of --nomad-version")
+	addCmd.Flags().StringVar(&imageFlags.NomadClient, "nomad-client-image", "", "Nomad client image, overrides the image of --nomad-version")
+	addCmd.Flags().StringVar(&imageFlags.Consul, "consul-image", "", "Consul image, overrides the image of --consul-version")
+	addCmd.Flags().StringVar(&imageFlags.Vault, "vault-image", "", "Vault image, overrides the image of --vault-version")
+	addCmd.Flags().StringVar(&imageFlags.LoadBalancer, "lb-image", "", "Load balancer image, defaults to "+loadbalancer.DefaultLBImage)
+	addCmd.Flags().BoolVar(&nomadACL, "acl", false, "Enable the nomad acl system, the bootstrap token is exported by cluster env")
+	addCmd.Flags().BoolVar(&consulACL, "consul-acl", false, "Enable the consul acl system, vault and nomad get tokens with least privilege policies")
+	addCmd.Flags().BoolVar(&withTLS, "tls", false, "Secure nomad, consul and vault with certificates of a generated CA, cluster env exports its path")
+	addCmd.Flags().BoolVar(&workloadIdentity, "workload-identity", false, "Let jobs log in to vault with their workload identity instead of server derived tokens, requires nomad 1.7")
+	addCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to a cluster config file, flags override its values")
+
+	destroyCmd.Flags().BoolVar(&keepRegistryCache, "keep-registry-cache", false, "Keep the images cached by the registry mirror for the next cluster with the same name")
 
-	cmd.AddCommand(addCmd, destroyCmd, stopCmd, startCmd)
+	cmd.AddCommand(addCmd, destroyCmd, stopCmd, startCmd, newListCommand(), newWaitCommand(), newEnvCommand(), newSnapshotCommand())
 
 	return cmd
 }
+
+// createConfig builds the cluster config from the config file (if any),
+// overriding its values with the name argument and explicitly set flags.
+func createConfig(cmd *cobra.Command, args []string) (*cluster.ClusterConfig, error) {
+	config := &cluster.ClusterConfig{
+		ServerCount:          serverCount,
+		WorkerCount:          workerCount,
+		ConsulServerCount:    consulServerCount,
+		ExtraCerts:           extraCerts,
+		PortsToExpose:        portsToExpose,
+		Registry:             withRegistry,
+		RegistryPort:         registryPort,
+		RegistryMirror:       withRegistryMirror,
+		RegistryMirrorRemote: registryMirrorRemote,
+		NomadACL:             nomadACL,
+		ConsulACL:            consulACL,
+		TLS:                  withTLS,
+		WorkloadIdentity:     workloadIdentity,
+	}
+
+	if configFile != "" {
+		fileConfig, err := cluster.LoadConfigFile(configFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config = fileConfig
+	}
+
+	if len(args) > 0 {
+		config.ClusterName = args[0]
+	}
+
+	flags := cmd.Flags()
+
+	if flags.Changed("servers") {
+		config.ServerCount = serverCount
+		config.CountsSet.Servers = true
+	}
+
+	if flags.Changed("worker-count") {
+		config.WorkerCount = workerCount
+		config.CountsSet.Workers = true
+	}
+
+	if flags.Changed("consul-servers") {
+		config.ConsulServerCount = consulServerCount
+		config.CountsSet.ConsulServers = true
+	}
+
+	if flags.Changed("extra-certs") {
+		config.ExtraCerts = extraCerts
+	}
+
+	if flags.Changed("ports") {
+		config.PortsToExpose = portsToExpose
+	}
+
+	if flags.Changed("registry") {
+		config.Registry = withRegistry
+	}
+
+	if flags.Changed("registry-port") {
+		config.RegistryPort = registryPort
+	}
+
+	if flags.Changed("acl") {
+		config.NomadACL = nomadACL
+	}
+
+	if flags.Changed("consul-acl") {
+		config.ConsulACL = consulACL
+	}
+
+	if flags.Changed("workload-identity") {
+		config.WorkloadIdentity = workloadIdentity
+	}
+
+	if flags.Changed("tls") {
+		config.TLS = withTLS
+	}
+
+	if flags.Changed("registry-mirror") {
+		config.RegistryMirror = withRegistryMirror
+	}
+
+	if flags.Changed("registry-mirror-remote") {
+		config.RegistryMirrorRemote = registryMirrorRemote
+	}
+
+	overrides := map[string]*string{
+		"nomad-version":      &config.Versions.Nomad,
+		"consul-version":     &config.Versions.Consul,
+		"vault-version":      &config.Versions.Vault,
+		"nomad-server-image": &config.Images.NomadServer,
+		"nomad-client-image": &config.Images.NomadClient,
+		"consul-image":       &config.Images.Consul,
+		"vault-image":        &config.Images.Vault,
+		"lb-image":           &config.Images.LoadBalancer,
+	}
+
+	for name, target := range overrides {
+		if flags.Changed(name) {
+			*target, _ = flags.GetString(name)
+		}
+	}
+
+	if flags.Changed("api-port-offset") {
+		config.APIPortOffset = &apiPortOffset
+	}
+
+	config.KeepOnFailure = keepOnFailure
+	config.ReadyTimeout = readyTimeout
+
+	if config.ClusterName == "" {
+		return nil, errors.New("cluster name is required, pass NAME or set name in the config file")
+	}
+
+	if err := cluster.ValidateClusterName(config.ClusterName); err != nil {
+		return nil, err
+	}
+
+	if config.ServerCount < 1 {
+		return nil, errors.New("at least one nomad server is required")
+	}
+
+	if config.APIPortOffset != nil && *config.APIPortOffset < 0 {
+		return nil, errors.New("api port offset must not be negative")
+	}
+
+	if config.RegistryPort < 1 || config.RegistryPort > 65535 {
+		return nil, errors.New("registry port must be between 1 and 65535")
+	}
+
+	if config.ConsulServerCount < 1 {
+		return nil, errors.New("at least one consul server is required")
+	}
+
+	if config.ServerCount%2 == 0 {
+		log.WithField("servers", config.ServerCount).Warn("even number of nomad servers doesn't improve fault tolerance")
+	}
+
+	return config, nil
+}
+
+// clearContext unsets the current context when it points to the deleted cluster.
+func clearContext(clusterName string) error {
+	config, err := state.LoadUserConfig()
+
+	if err != nil {
+		return err
+	}
+
+	if config.CurrentContext != clusterName {
+		return nil
+	}
+
+	config.CurrentContext = ""
+
+	return state.SaveUserConfig(config)
+}
@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"fmt"
+	"n3d/cluster"
+	"n3d/cmd/util"
+	"n3d/runtimes"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var envFormat string
+
+var envFormatters = map[string]func(cluster.EnvVar) string{
+	"bash": func(v cluster.EnvVar) string {
+		return fmt.Sprintf("export %s=%s", v.Name, shellQuote(v.Value))
+	},
+	"direnv": func(v cluster.EnvVar) string {
+		return fmt.Sprintf("export %s=%s", v.Name, shellQuote(v.Value))
+	},
+	"fish": func(v cluster.EnvVar) string {
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v.Value)
+		return fmt.Sprintf("set -gx %s '%s';", v.Name, value)
+	},
+	"powershell": func(v cluster.EnvVar) string {
+		return fmt.Sprintf("$Env:%s = '%s'", v.Name, strings.ReplaceAll(v.Value, "'", "''"))
+	},
+	"dotenv": func(v cluster.EnvVar) string {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v.Value)
+		return fmt.Sprintf("%s=\"%s\"", v.Name, value)
+	},
+}
+
+func newEnvCommand() *cobra.Command {
+	envCmd := &cobra.Command{
+		Use:          "env NAME",
+		Args:         cobra.RangeArgs(0, 1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			formatter, ok := envFormatters[envFormat]
+
+			if !ok {
+				return fmt.Errorf("unsupported format %q, use one of bash, fish, powershell, dotenv, direnv", envFormat)
+			}
+
+			runtime := runtimes.SelectedRuntime
+
+			clusterName, err := util.ClusterName(args)
+
+			if err != nil {
+				return err
+			}
+
+			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
+				ClusterName: clusterName,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			if cl == nil {
+				return fmt.Errorf("cluster %s doesn't exist", clusterName)
+			}
+
+			for _, v := range cl.Env() {
+				fmt.Fprintln(cmd.OutOrStdout(), formatter(v))
+			}
+
+			return nil
+		},
+	}
+
+	envCmd.Flags().StringVarP(&envFormat, "format", "f", "bash", "Output format: bash, fish, powershell, dotenv or direnv")
+
+	return envCmd
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,173 @@
+package cluster
+
+import (
+	"fmt"
+	"n3d/cluster"
+	"n3d/constants"
+	"n3d/runtimes"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var showNodes bool
+
+func newListCommand() *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runtime := runtimes.SelectedRuntime
+
+			clusters, err := cluster.ClusterList(cmd.Context(), runtime)
+
+			if err != nil {
+				log.WithError(err).Error("unable to list clusters")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			defer w.Flush()
+
+			if showNodes {
+				printNodes(w, clusters)
+				return
+			}
+
+			fmt.Fprintln(w, "NAME\tSTATUS\tNOMAD SERVERS\tNOMAD CLIENTS\tCONSUL\tVAULT\tLOADBALANCER\tAGE\tENDPOINTS")
+
+			for _, cl := range clusters {
+				nodes := cl.Nodes()
+
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					cl.Name(),
+					clusterStatus(nodes),
+					nodeCount(nodes, constants.NomadServer),
+					nodeCount(nodes, constants.NomadClient),
+					nodeCount(nodes, constants.Consul),
+					nodeCount(nodes, constants.Vault),
+					nodeCount(nodes, constants.LoadBalancer),
+					formatAge(clusterCreated(nodes)),
+					formatEndpoints(cl.HostPorts()),
+				)
+			}
+		},
+	}
+
+	listCmd.Flags().BoolVar(&showNodes, "nodes", false, "Show every node of the clusters")
+
+	return listCmd
+}
+
+func printNodes(w *tabwriter.Writer, clusters []*cluster.Cluster) {
+	fmt.Fprintln(w, "CLUSTER\tNAME\tTYPE\tVERSION\tSTATE\tAGE")
+
+	for _, cl := range clusters {
+		for _, n := range cl.Nodes() {
+			version := n.Labels[constants.Version]
+			if version == "" {
+				version = "-"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				cl.Name(),
+				n.Name,
+				n.Labels[constants.NodeType],
+				version,
+				n.State,
+				formatAge(n.Created),
+			)
+		}
+	}
+}
+
+// nodeCount prints running/total nodes of the given type.
+func nodeCount(nodes []*runtimes.Node, typ string) string {
+	total, running := 0, 0
+
+	for _, n := range nodes {
+		if n.Labels[constants.NodeType] != typ {
+			continue
+		}
+
+		total++
+
+		if n.IsRunning() {
+			running++
+		}
+	}
+
+	return fmt.Sprintf("%d/%d", running, total)
+}
+
+func clusterStatus(nodes []*runtimes.Node) string {
+	running := 0
+
+	for _, n := range nodes {
+		if n.IsRunning() {
+			running++
+		}
+	}
+
+	switch running {
+	case len(nodes):
+		return "running"
+	case 0:
+		return "exited"
+	default:
+		return "degraded"
+	}
+}
+
+func clusterCreated(nodes []*runtimes.Node) time.Time {
+	created := time.Time{}
+
+	for _, n := range nodes {
+		if created.IsZero() || n.Created.Before(created) {
+			created = n.Created
+		}
+	}
+
+	return created
+}
+
+func formatAge(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	d := time.Since(t)
+
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+func formatEndpoints(ports map[string]string) string {
+	if len(ports) == 0 {
+		return "-"
+	}
+
+	endpoints := make([]string, 0, len(ports))
+
+	for port, hostPort := range ports {
+		endpoints = append(endpoints, fmt.Sprintf("%s->%s", hostPort, port))
+	}
+
+	sort.Strings(endpoints)
+
+	return strings.Join(endpoints, ",")
+}
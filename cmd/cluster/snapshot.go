@@ -0,0 +1,126 @@
+package cluster
+
+import (
+	"fmt"
+	"n3d/cluster"
+	"n3d/cmd/util"
+	"n3d/runtimes"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "snapshot",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				log.Error("Couldn't get help text")
+				log.Fatalln(err)
+			}
+		},
+	}
+
+	saveCmd := &cobra.Command{
+		Use:          "save [NAME] FILE",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runtime := runtimes.SelectedRuntime
+
+			cl, file, err := snapshotArgs(cmd, args)
+
+			if err != nil {
+				return err
+			}
+
+			// the archive holds the vault keys, so it is only readable by the user
+			tmp, err := os.CreateTemp(filepath.Dir(file), ".n3d-snapshot-*")
+
+			if err != nil {
+				return err
+			}
+
+			defer os.Remove(tmp.Name())
+
+			if err := cluster.SnapshotSave(cmd.Context(), cl, runtime, tmp); err != nil {
+				tmp.Close()
+				return err
+			}
+
+			if err := tmp.Close(); err != nil {
+				return err
+			}
+
+			if err := os.Rename(tmp.Name(), file); err != nil {
+				return err
+			}
+
+			log.WithField("file", file).Info("snapshot saved.")
+
+			return nil
+		},
+	}
+
+	restoreCmd := &cobra.Command{
+		Use:          "restore [NAME] FILE",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runtime := runtimes.SelectedRuntime
+
+			cl, file, err := snapshotArgs(cmd, args)
+
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(file)
+
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			if err := cluster.SnapshotRestore(cmd.Context(), cl, runtime, f); err != nil {
+				return err
+			}
+
+			log.WithField("file", file).Info("snapshot restored.")
+
+			return nil
+		},
+	}
+
+	cmd.AddCommand(saveCmd, restoreCmd)
+
+	return cmd
+}
+
+// snapshotArgs resolves the [NAME] FILE arguments, NAME defaults to the current context.
+func snapshotArgs(cmd *cobra.Command, args []string) (*cluster.Cluster, string, error) {
+	file := args[len(args)-1]
+
+	clusterName, err := util.ClusterName(args[:len(args)-1])
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	cl, err := cluster.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, cluster.ClusterConfig{
+		ClusterName: clusterName,
+	})
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cl == nil {
+		return nil, "", fmt.Errorf("cluster %s doesn't exist", clusterName)
+	}
+
+	return cl, file, nil
+}
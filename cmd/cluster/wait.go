@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"fmt"
+	"n3d/cluster"
+	"n3d/cmd/util"
+	"n3d/runtimes"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var waitFor string
+var waitTimeout time.Duration
+
+func newWaitCommand() *cobra.Command {
+	waitCmd := &cobra.Command{
+		Use:          "wait NAME",
+		Args:         cobra.RangeArgs(0, 1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if waitFor != "ready" {
+				return fmt.Errorf("unsupported condition %q, only ready is supported", waitFor)
+			}
+
+			runtime := runtimes.SelectedRuntime
+
+			clusterName, err := util.ClusterName(args)
+
+			if err != nil {
+				return err
+			}
+
+			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
+				ClusterName: clusterName,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			if cl == nil {
+				return fmt.Errorf("cluster %s doesn't exist", clusterName)
+			}
+
+			if err := cluster.ClusterWait(cmd.Context(), cl, runtime, waitTimeout); err != nil {
+				return err
+			}
+
+			log.WithField("cluster-name", clusterName).Info("cluster is ready.")
+
+			return nil
+		},
+	}
+
+	waitCmd.Flags().StringVar(&waitFor, "for", "ready", "Condition to wait for")
+	waitCmd.Flags().DurationVar(&waitTimeout, "timeout", cluster.DefaultReadyTimeout, "Time to wait for every component")
+
+	return waitCmd
+}
@@ -0,0 +1,84 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"n3d/cluster"
+	"n3d/runtimes"
+	"n3d/state"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewContextCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "context",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				log.Error("Couldn't get help text")
+				log.Fatalln(err)
+			}
+		},
+	}
+
+	useCmd := &cobra.Command{
+		Use:          "use NAME",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := cluster.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, cluster.ClusterConfig{
+				ClusterName: args[0],
+			})
+
+			if err != nil {
+				return err
+			}
+
+			if cl == nil {
+				return fmt.Errorf("cluster %s doesn't exist", args[0])
+			}
+
+			config, err := state.LoadUserConfig()
+
+			if err != nil {
+				return err
+			}
+
+			config.CurrentContext = args[0]
+
+			if err := state.SaveUserConfig(config); err != nil {
+				return err
+			}
+
+			log.WithField("cluster-name", args[0]).Info("switched context.")
+
+			return nil
+		},
+	}
+
+	showCmd := &cobra.Command{
+		Use:          "show",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := state.LoadUserConfig()
+
+			if err != nil {
+				return err
+			}
+
+			if config.CurrentContext == "" {
+				return errors.New("no context is selected")
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), config.CurrentContext)
+
+			return nil
+		},
+	}
+
+	cmd.AddCommand(useCmd, showCmd)
+
+	return cmd
+}
@@ -0,0 +1,60 @@
+package image
+
+import (
+	"fmt"
+	"n3d/cluster"
+	"n3d/cmd/util"
+	"n3d/runtimes"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var clusterName string
+
+func NewImageCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "image",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				log.Error("Couldn't get help text")
+				log.Fatalln(err)
+			}
+		},
+	}
+
+	importCmd := &cobra.Command{
+		Use:          "import IMAGE...",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runtime := runtimes.SelectedRuntime
+
+			name, err := util.ClusterName([]string{clusterName})
+
+			if err != nil {
+				return err
+			}
+
+			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
+				ClusterName: name,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			if cl == nil {
+				return fmt.Errorf("cluster %s doesn't exist", name)
+			}
+
+			return cluster.ImageImport(cmd.Context(), cl, runtime, args)
+		},
+	}
+
+	importCmd.Flags().StringVar(&clusterName, "cluster", "", "Cluster to import the images into, defaults to the current context")
+
+	cmd.AddCommand(importCmd)
+
+	return cmd
+}
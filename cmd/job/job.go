@@ -0,0 +1,158 @@
+package job
+
+import (
+	"fmt"
+	"n3d/cluster"
+	"n3d/cmd/util"
+	"n3d/nomad"
+	"n3d/runtimes"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const defaultTimeout = 5 * time.Minute
+
+var clusterName string
+var timeout time.Duration
+var detach bool
+var purge bool
+var namespace string
+
+func NewJobCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "job",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				log.Error("Couldn't get help text")
+				log.Fatalln(err)
+			}
+		},
+	}
+
+	runCmd := &cobra.Command{
+		Use:          "run FILE",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			api, err := nomadAPI(cmd)
+
+			if err != nil {
+				return err
+			}
+
+			job, ref, err := cluster.LoadJob(ctx, api, args[0])
+
+			if err != nil {
+				return err
+			}
+
+			plan, err := cluster.JobPlan(ctx, api, ref, job)
+
+			if plan != nil {
+				printPlan(cmd, plan)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			return cluster.JobRun(ctx, api, ref, job, cluster.JobRunOptions{
+				Timeout: timeout,
+				Detach:  detach,
+			})
+		},
+	}
+
+	planCmd := &cobra.Command{
+		Use:          "plan FILE",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			api, err := nomadAPI(cmd)
+
+			if err != nil {
+				return err
+			}
+
+			job, ref, err := cluster.LoadJob(cmd.Context(), api, args[0])
+
+			if err != nil {
+				return err
+			}
+
+			plan, err := cluster.JobPlan(cmd.Context(), api, ref, job)
+
+			if plan != nil {
+				printPlan(cmd, plan)
+			}
+
+			return err
+		},
+	}
+
+	stopCmd := &cobra.Command{
+		Use:          "stop JOB",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			api, err := nomadAPI(cmd)
+
+			if err != nil {
+				return err
+			}
+
+			return cluster.JobStop(cmd.Context(), api, &nomad.JobRef{ID: args[0], Namespace: namespace}, purge, timeout)
+		},
+	}
+
+	for _, c := range []*cobra.Command{runCmd, planCmd, stopCmd} {
+		c.Flags().StringVar(&clusterName, "cluster", "", "Cluster to use, defaults to the current context")
+	}
+
+	runCmd.Flags().DurationVar(&timeout, "timeout", defaultTimeout, "Time to wait for the deployment to become healthy")
+	runCmd.Flags().BoolVarP(&detach, "detach", "d", false, "Don't wait for the evaluation and deployment of the job")
+	stopCmd.Flags().DurationVar(&timeout, "timeout", defaultTimeout, "Time to wait for the allocations to stop")
+	stopCmd.Flags().BoolVar(&purge, "purge", false, "Remove the job from the job list as well")
+	stopCmd.Flags().StringVar(&namespace, "namespace", "default", "Namespace of the job")
+
+	cmd.AddCommand(runCmd, planCmd, stopCmd)
+
+	return cmd
+}
+
+// nomadAPI returns a client of the selected cluster, NOMAD_TOKEN takes
+// precedence over the bootstrap token of the cluster.
+func nomadAPI(cmd *cobra.Command) (*nomad.APIClient, error) {
+	name, err := util.ClusterName([]string{clusterName})
+
+	if err != nil {
+		return nil, err
+	}
+
+	cl, err := cluster.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, cluster.ClusterConfig{
+		ClusterName: name,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cl == nil {
+		return nil, fmt.Errorf("cluster %s doesn't exist", name)
+	}
+
+	token := os.Getenv("NOMAD_TOKEN")
+	if token == "" {
+		token = cl.NomadToken
+	}
+
+	return cl.NomadAPI(token)
+}
@@ -0,0 +1,129 @@
+package job
+
+import (
+	"fmt"
+	"io"
+	"n3d/nomad"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// diffMarkers follow the markers of nomad job plan.
+var diffMarkers = map[string]string{
+	"Added":   "+",
+	"Deleted": "-",
+	"Edited":  "+/-",
+	"None":    "",
+}
+
+func printPlan(cmd *cobra.Command, plan *nomad.PlanResponse) {
+	w := cmd.OutOrStdout()
+
+	if plan.Diff != nil {
+		printJobDiff(w, plan.Diff)
+	}
+
+	if plan.Warnings != "" {
+		fmt.Fprintf(w, "\nWarnings:\n%s\n", strings.TrimSpace(plan.Warnings))
+	}
+
+	fmt.Fprintf(w, "\nJob Modify Index: %d\n", plan.JobModifyIndex)
+}
+
+func printJobDiff(w io.Writer, diff *nomad.JobDiff) {
+	if diff.Type == "None" {
+		fmt.Fprintf(w, "Job: %q has no changes\n", diff.ID)
+		return
+	}
+
+	fmt.Fprintf(w, "%s Job: %q\n", diffMarkers[diff.Type], diff.ID)
+	printFields(w, diff.Fields, 1)
+	printObjects(w, diff.Objects, 1)
+
+	for _, tg := range diff.TaskGroups {
+		if tg.Type == "None" && len(tg.Updates) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s Task Group: %q%s\n", marker(tg.Type), tg.Name, updates(tg.Updates))
+		printFields(w, tg.Fields, 2)
+		printObjects(w, tg.Objects, 2)
+
+		for _, task := range tg.Tasks {
+			if task.Type == "None" {
+				continue
+			}
+
+			annotations := ""
+			if len(task.Annotations) > 0 {
+				annotations = fmt.Sprintf(" (%s)", strings.Join(task.Annotations, ", "))
+			}
+
+			fmt.Fprintf(w, "  %s Task: %q%s\n", marker(task.Type), task.Name, annotations)
+			printFields(w, task.Fields, 3)
+			printObjects(w, task.Objects, 3)
+		}
+	}
+}
+
+func printFields(w io.Writer, fields []*nomad.FieldDiff, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	for _, f := range fields {
+		switch f.Type {
+		case "Added":
+			fmt.Fprintf(w, "%s+ %s: %q\n", indent, f.Name, f.New)
+		case "Deleted":
+			fmt.Fprintf(w, "%s- %s: %q\n", indent, f.Name, f.Old)
+		case "Edited":
+			fmt.Fprintf(w, "%s+/- %s: %q => %q\n", indent, f.Name, f.Old, f.New)
+		}
+	}
+}
+
+func printObjects(w io.Writer, objects []*nomad.ObjectDiff, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	for _, o := range objects {
+		if o.Type == "None" {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s%s %s {\n", indent, diffMarkers[o.Type], o.Name)
+		printFields(w, o.Fields, depth+1)
+		printObjects(w, o.Objects, depth+1)
+		fmt.Fprintf(w, "%s}\n", indent)
+	}
+}
+
+// marker keeps unchanged task groups aligned with the changed ones.
+func marker(diffType string) string {
+	if m := diffMarkers[diffType]; m != "" {
+		return m
+	}
+
+	return " "
+}
+
+// updates summarizes the scheduler decisions of a task group, like "(1 create, 2 ignore)".
+func updates(counts map[string]uint64) string {
+	if len(counts) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[name], name))
+	}
+
+	return fmt.Sprintf(" (%s)", strings.Join(parts, ", "))
+}
@@ -0,0 +1,83 @@
+package logs
+
+import (
+	"fmt"
+	"n3d/cluster"
+	"n3d/cmd/util"
+	"n3d/runtimes"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var follow bool
+var since string
+
+func NewLogsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "logs CLUSTER [NODE...]",
+		Args:         cobra.ArbitraryArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runtime := runtimes.SelectedRuntime
+
+			name, err := util.ClusterName(args)
+
+			if err != nil {
+				return err
+			}
+
+			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
+				ClusterName: name,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			if cl == nil {
+				return fmt.Errorf("cluster %s doesn't exist", name)
+			}
+
+			var names []string
+			if len(args) > 1 {
+				names = args[1:]
+			}
+
+			nodes, err := cl.FindNodes(names)
+
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			out := newOutput(cmd.OutOrStdout(), cmd.ErrOrStderr(), nodes, colorEnabled())
+			defer out.flush()
+
+			return cluster.NodeLogs(ctx, runtime, nodes, runtimes.LogsOptions{
+				Follow: follow,
+				Since:  since,
+			}, out.writers)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow the logs until interrupted")
+	cmd.Flags().StringVar(&since, "since", "", "Show logs since a timestamp or a relative time like 10m")
+
+	return cmd
+}
+
+// colorEnabled colors the prefixes when stdout is a terminal, NO_COLOR turns them off.
+func colorEnabled() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	info, err := os.Stdout.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,103 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"n3d/runtimes"
+	"sync"
+)
+
+// colors cycle over the nodes, the ansi codes of cyan, yellow, green, magenta, blue and red.
+var colors = []int{36, 33, 32, 35, 34, 31}
+
+// output writes the lines of all nodes prefixed with their name, the lines of
+// the nodes are written whole so they don't interleave.
+type output struct {
+	mu     sync.Mutex
+	stdout io.Writer
+	stderr io.Writer
+	prefix map[string]string
+	lines  []*lineWriter
+}
+
+func newOutput(stdout io.Writer, stderr io.Writer, nodes []*runtimes.Node, color bool) *output {
+	width := 0
+	for _, n := range nodes {
+		if len(n.Name) > width {
+			width = len(n.Name)
+		}
+	}
+
+	o := &output{stdout: stdout, stderr: stderr, prefix: make(map[string]string)}
+
+	for i, n := range nodes {
+		prefix := fmt.Sprintf("%-*s | ", width, n.Name)
+
+		if color {
+			prefix = fmt.Sprintf("\x1b[%dm%s\x1b[0m", colors[i%len(colors)], prefix)
+		}
+
+		o.prefix[n.Name] = prefix
+	}
+
+	return o
+}
+
+// writers returns the stdout and stderr writers of the node.
+func (o *output) writers(node *runtimes.Node) (io.Writer, io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	stdout := &lineWriter{output: o, out: o.stdout, prefix: o.prefix[node.Name]}
+	stderr := &lineWriter{output: o, out: o.stderr, prefix: o.prefix[node.Name]}
+	o.lines = append(o.lines, stdout, stderr)
+
+	return stdout, stderr
+}
+
+// flush writes the last lines which didn't end with a newline.
+func (o *output) flush() {
+	o.mu.Lock()
+	lines := o.lines
+	o.mu.Unlock()
+
+	for _, w := range lines {
+		if w.buf.Len() > 0 {
+			_, _ = w.Write([]byte("\n"))
+		}
+	}
+}
+
+type lineWriter struct {
+	output *output
+	out    io.Writer
+	prefix string
+	buf    bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.output.mu.Lock()
+	defer w.output.mu.Unlock()
+
+	w.buf.Write(p)
+
+	for {
+		line, err := w.buf.ReadBytes('\n')
+
+		if err != nil {
+			// keep the incomplete line for the next write
+			w.buf.Reset()
+			w.buf.Write(line)
+
+			return len(p), nil
+		}
+
+		// logs of nodes with a tty end their lines with \r\n
+		line = bytes.TrimRight(line, "\r\n")
+
+		if _, err := fmt.Fprintf(w.out, "%s%s\n", w.prefix, line); err != nil {
+			return 0, err
+		}
+	}
+}
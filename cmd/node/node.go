@@ -0,0 +1,98 @@
+package node
+
+import (
+	"n3d/cluster"
+	"n3d/cmd/util"
+	"n3d/runtimes"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var clusterName string
+var count int
+var extraCerts []string
+
+func NewNodeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "node",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				log.Error("Couldn't get help text")
+				log.Fatalln(err)
+			}
+		},
+	}
+
+	addCmd := &cobra.Command{
+		Use:  "add",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runtime := runtimes.SelectedRuntime
+
+			if count < 1 {
+				log.Errorf("--count must be at least 1, got %d", count)
+				return
+			}
+
+			name, err := util.ClusterName([]string{clusterName})
+
+			if err != nil {
+				log.WithError(err).Error("unable to add nodes")
+				return
+			}
+
+			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
+				ClusterName: name,
+			})
+
+			if err != nil {
+				log.WithError(err).Error("unable to fetch cluster")
+				return
+			}
+
+			if cl == nil {
+				log.Info("cluster doesn't exist")
+				return
+			}
+
+			_, err = cluster.NodeAdd(cmd.Context(), cl, runtime, cluster.NodeAddOptions{
+				Count:      count,
+				ExtraCerts: extraCerts,
+			})
+
+			if err != nil {
+				log.WithError(err).Error("unable to add nodes")
+			}
+		},
+	}
+
+	removeCmd := &cobra.Command{
+		Use:  "remove NAME",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runtime := runtimes.SelectedRuntime
+
+			cl, _, err := cluster.FindNode(cmd.Context(), runtime, args[0])
+
+			if err != nil {
+				log.WithError(err).Error("unable to remove node")
+				return
+			}
+
+			err = cluster.NodeRemove(cmd.Context(), cl, runtime, args[0])
+
+			if err != nil {
+				log.WithError(err).Error("unable to remove node")
+			}
+		},
+	}
+
+	addCmd.Flags().StringVar(&clusterName, "cluster", "", "Cluster to add the nodes to, defaults to the current context")
+	addCmd.Flags().IntVar(&count, "count", 1, "Nomad workers count to add")
+	addCmd.Flags().StringArrayVar(&extraCerts, "extra-certs", []string{}, "Extra certs to put in container")
+
+	cmd.AddCommand(addCmd, removeCmd)
+
+	return cmd
+}
@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"fmt"
+	"n3d/cluster"
+	"n3d/cmd/util"
+	"n3d/registry"
+	"n3d/runtimes"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var clusterName string
+var port int
+
+func NewRegistryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "registry",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				log.Error("Couldn't get help text")
+				log.Fatalln(err)
+			}
+		},
+	}
+
+	createCmd := &cobra.Command{
+		Use:          "create",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runtime := runtimes.SelectedRuntime
+
+			name, err := util.ClusterName([]string{clusterName})
+
+			if err != nil {
+				return err
+			}
+
+			cl, err := cluster.ClusterGet(cmd.Context(), runtime, cluster.ClusterConfig{
+				ClusterName: name,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			if cl == nil {
+				return fmt.Errorf("cluster %s doesn't exist", name)
+			}
+
+			_, err = cluster.RegistryCreate(cmd.Context(), cl, runtime, port)
+
+			return err
+		},
+	}
+
+	createCmd.Flags().StringVar(&clusterName, "cluster", "", "Cluster to add the registry to, defaults to the current context")
+	createCmd.Flags().IntVar(&port, "port", registry.DefaultPort, "Host port of the registry")
+
+	cmd.AddCommand(createCmd)
+
+	return cmd
+}
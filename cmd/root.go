@@ -3,6 +3,12 @@ package cmd
 import (
 	"log"
 	"n3d/cmd/cluster"
+	"n3d/cmd/context"
+	"n3d/cmd/image"
+	"n3d/cmd/job"
+	"n3d/cmd/logs"
+	"n3d/cmd/node"
+	"n3d/cmd/registry"
 	"n3d/runtimes"
 
 	"github.com/spf13/cobra"
@@ -10,8 +16,9 @@ import (
 
 func NewRootCommand() *cobra.Command {
 	rootCmd := &cobra.Command{
-		Use:   "N3D",
-		Short: "N3D will be neat tool for local nomad env",
+		Use:           "N3D",
+		Short:         "N3D will be neat tool for local nomad env",
+		SilenceErrors: true,
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := cmd.Usage(); err != nil {
 				log.Fatalln(err)
@@ -22,6 +29,12 @@ func NewRootCommand() *cobra.Command {
 	cobra.OnInitialize(initRuntime)
 
 	rootCmd.AddCommand(cluster.NewClusterCommand())
+	rootCmd.AddCommand(node.NewNodeCommand())
+	rootCmd.AddCommand(context.NewContextCommand())
+	rootCmd.AddCommand(image.NewImageCommand())
+	rootCmd.AddCommand(registry.NewRegistryCommand())
+	rootCmd.AddCommand(job.NewJobCommand())
+	rootCmd.AddCommand(logs.NewLogsCommand())
 
 	return rootCmd
 }
@@ -0,0 +1,28 @@
+package util
+
+import (
+	"errors"
+	"n3d/state"
+)
+
+var ErrNoCluster = errors.New("no cluster selected, pass NAME or run n3d context use NAME")
+
+// ClusterName returns the cluster passed as the first argument, falling back
+// to the active context.
+func ClusterName(args []string) (string, error) {
+	if len(args) > 0 && args[0] != "" {
+		return args[0], nil
+	}
+
+	config, err := state.LoadUserConfig()
+
+	if err != nil {
+		return "", err
+	}
+
+	if config.CurrentContext == "" {
+		return "", ErrNoCluster
+	}
+
+	return config.CurrentContext, nil
+}
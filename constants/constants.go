@@ -6,10 +6,21 @@ const (
 	LoadBalancer   = "LoadBalancer"
 	Vault          = "Vault"
 	Consul         = "Consul"
+	Registry       = "Registry"
+	RegistryMirror = "RegistryMirror"
 	NodeType       = "NodeType"
 	ClusterName    = "ClusterName"
 	VaultUnsealKey = "UnsealKey"
 	VaultRootToken = "VaultRootToken"
 	VolumeType     = "VolumeType"
 	NodeName       = "NodeName"
+	ExposedPorts   = "ExposedPorts"
+	PortOffset     = "PortOffset"
+	RegistryPort   = "RegistryPort"
+	Version        = "Version"
+	Image          = "Image"
+	TLS            = "TLS"
+
+	// HostPortLabelPrefix prefixes the labels recording the host port of every load balancer port.
+	HostPortLabelPrefix = "HostPort."
 )
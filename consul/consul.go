@@ -2,24 +2,120 @@ package consul
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"n3d/certs"
 	"n3d/constants"
 	"n3d/runtimes"
+	"n3d/wait"
+	"time"
 )
 
 type ConsulConfiguration struct {
 	ClusterName string
 	NetworkName string
 	Id          int
+	ServerCount int
+	Version     string
+	// Image overrides the image of the version.
+	Image string
+	// ManagementToken enables the acl system with a default deny policy, it is
+	// the initial management token of the cluster.
+	ManagementToken string
+	// TLS serves the http api over https on the same port and encrypts the rpc traffic.
+	TLS *certs.NodeCerts
+	// GossipKey encrypts the serf traffic, all servers have to use the same key.
+	GossipKey string
 }
 
 const (
-	imageName = "consul:1.15.4"
+	DefaultVersion = "1.15.4"
+	serfLanPort    = 28301
+	snapshotPath   = "/tmp/n3d-consul.snap"
 )
 
+func ServerName(clusterName string, id int) string {
+	return fmt.Sprintf("%s-consul-server-%d", clusterName, id)
+}
+
+// ServiceName is the network alias shared by the consul servers, it resolves
+// to the running servers so clients keep working when one of them is down.
+func ServiceName(clusterName string) string {
+	return fmt.Sprintf("%s-consul", clusterName)
+}
+
+// Address returns the http address of the consul servers.
+func Address(clusterName string) string {
+	return fmt.Sprintf("%s:8500", ServiceName(clusterName))
+}
+
+// Image returns the consul image of the version, the official consul image
+// isn't published anymore since 1.16.
+func Image(version string) string {
+	return fmt.Sprintf("hashicorp/consul:%s", version)
+}
+
 func NewConsulServer(ctx context.Context, runtime runtimes.Runtime, config ConsulConfiguration) (*runtimes.Node, error) {
-	nodeName := fmt.Sprintf("%s-consul-server-%d", config.ClusterName, config.Id)
-	volName := fmt.Sprintf("%s-consul-vol", config.ClusterName)
+	version, image := config.Version, config.Image
+	if image == "" {
+		if version == "" {
+			version = DefaultVersion
+		}
+
+		image = Image(version)
+	}
+
+	nodeName := ServerName(config.ClusterName, config.Id)
+	volName := fmt.Sprintf("%s-consul-vol-%d", config.ClusterName, config.Id)
+
+	serverCount := config.ServerCount
+	if serverCount < 1 {
+		serverCount = 1
+	}
+
+	ports := fmt.Sprintf("grpc = 8502 serf_lan = %d", serfLanPort)
+	if config.TLS != nil {
+		ports += " http = -1 https = 8500"
+	}
+
+	cmd := []string{"agent", "-server", "-ui", fmt.Sprintf("-bootstrap-expect=%d", serverCount),
+		"-client=0.0.0.0", "-hcl=connect { enabled = true }", fmt.Sprintf("-hcl=ports { %s }", ports)}
+
+	for i := 0; i < serverCount; i++ {
+		if i == config.Id {
+			continue
+		}
+
+		cmd = append(cmd, fmt.Sprintf("-retry-join=%s:%d", ServerName(config.ClusterName, i), serfLanPort))
+	}
+
+	if config.ManagementToken != "" {
+		cmd = append(cmd, fmt.Sprintf(`-hcl=acl { enabled = true default_policy = "deny" enable_token_persistence = true tokens { initial_management = "%s" agent = "%s" } }`,
+			config.ManagementToken, config.ManagementToken))
+	}
+
+	if config.GossipKey != "" {
+		cmd = append(cmd, "-encrypt="+config.GossipKey)
+	}
+
+	labels := map[string]string{
+		constants.NodeType:    constants.Consul,
+		constants.ClusterName: config.ClusterName,
+		constants.Version:     version,
+		constants.Image:       image,
+	}
+
+	var env []string
+	var files []*runtimes.FileInNode
+
+	if config.TLS != nil {
+		cmd = append(cmd, fmt.Sprintf(`-hcl=tls { defaults { ca_file = "%s" cert_file = "%s" key_file = "%s" verify_outgoing = true } internal_rpc { verify_incoming = true verify_server_hostname = true } }`,
+			certs.CAPath, certs.CertPath, certs.KeyPath))
+		env = []string{"CONSUL_HTTP_ADDR=https://127.0.0.1:8500", "CONSUL_CACERT=" + certs.CAPath}
+		files = config.TLS.Files()
+		labels[constants.TLS] = "true"
+	}
 
 	runtime.CreateVolume(ctx, volName, map[string]string{
 		constants.ClusterName: config.ClusterName,
@@ -28,11 +124,12 @@ func NewConsulServer(ctx context.Context, runtime runtimes.Runtime, config Consu
 	})
 
 	ctn, err := runtime.RunNode(ctx, runtimes.NodeConfig{
-		Image:       imageName,
+		Image:       image,
 		Name:        nodeName,
 		NetworkName: config.NetworkName,
-		Cmd: []string{"agent", "-server", "-ui", "-bootstrap-expect=1",
-			"-client=0.0.0.0", "-hcl=connect { enabled = true }", "-hcl=ports { grpc = 8502 serf_lan = 28301 }"},
+		Cmd:         cmd,
+		Env:         env,
+		Files:       files,
 		Volumes: []*runtimes.Volume{
 			{
 				Name:   volName,
@@ -40,10 +137,8 @@ func NewConsulServer(ctx context.Context, runtime runtimes.Runtime, config Consu
 				IsBind: false,
 			},
 		},
-		Labels: map[string]string{
-			constants.NodeType:    constants.Consul,
-			constants.ClusterName: config.ClusterName,
-		},
+		Labels:         labels,
+		NetworkAliases: []string{ServiceName(config.ClusterName)},
 	})
 
 	if err != nil {
@@ -52,3 +147,158 @@ func NewConsulServer(ctx context.Context, runtime runtimes.Runtime, config Consu
 
 	return ctn, nil
 }
+
+// Leader returns the raft leader known by the consul server, it is empty while there's no leader.
+func Leader(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node) (string, error) {
+	cmd := []string{"wget", "-q", "-O", "-", "http://127.0.0.1:8500/v1/status/leader"}
+
+	// busybox wget can't verify the api with the cluster CA
+	if certs.Scheme(node) == "https" {
+		cmd = []string{"curl", "-sSf", "--cacert", certs.CAPath, "https://127.0.0.1:8500/v1/status/leader"}
+	}
+
+	respText, err := runtime.Exec(ctx, node, cmd)
+
+	if err != nil {
+		return "", err
+	}
+
+	leader := ""
+	if err := json.Unmarshal([]byte(*respText), &leader); err != nil {
+		return "", fmt.Errorf("unable to parse consul leader: %q: %w", *respText, err)
+	}
+
+	return leader, nil
+}
+
+func WaitForLeader(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, timeout time.Duration) error {
+	return wait.For(ctx, "consul leader", timeout, func(ctx context.Context) (bool, error) {
+		leader, err := Leader(ctx, runtime, node)
+
+		return leader != "", err
+	})
+}
+
+// SnapshotSave takes a snapshot of the consul state, which includes the vault storage.
+func SnapshotSave(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, token string) ([]byte, error) {
+	defer removeSnapshot(ctx, runtime, node)
+
+	removeSnapshot(ctx, runtime, node)
+
+	if _, err := runtime.Exec(ctx, node, consulCmd(token, []string{"snapshot", "save"}, snapshotPath)); err != nil {
+		return nil, fmt.Errorf("unable to save consul snapshot: %w", err)
+	}
+
+	return runtime.ReadFile(ctx, node, snapshotPath)
+}
+
+func SnapshotRestore(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, token string, snapshot []byte) error {
+	defer removeSnapshot(ctx, runtime, node)
+
+	err := runtime.WriteFile(ctx, node, &runtimes.FileInNode{
+		Content:  snapshot,
+		Path:     snapshotPath,
+		FileMode: 0600,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := runtime.Exec(ctx, node, consulCmd(token, []string{"snapshot", "restore"}, snapshotPath)); err != nil {
+		return fmt.Errorf("unable to restore consul snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func removeSnapshot(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node) {
+	_, _ = runtime.Exec(ctx, node, []string{"rm", "-f", snapshotPath})
+}
+
+// Policies of the tokens n3d creates, they follow the vault consul storage and
+// the nomad consul integration guides.
+const (
+	VaultPolicy = `
+key_prefix "vault/" { policy = "write" }
+service "vault" { policy = "write" }
+agent_prefix "" { policy = "read" }
+session_prefix "" { policy = "write" }
+`
+
+	NomadServerPolicy = `
+agent_prefix "" { policy = "read" }
+node_prefix "" { policy = "read" }
+service_prefix "" { policy = "write" }
+acl = "write"
+`
+
+	NomadClientPolicy = `
+agent_prefix "" { policy = "read" }
+node_prefix "" { policy = "write" }
+service_prefix "" { policy = "write" }
+`
+)
+
+type aclTokenResponse struct {
+	SecretID string `json:"SecretID"`
+}
+
+// GenerateToken returns a random uuid, consul acl tokens have to be uuids.
+func GenerateToken() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate consul token: %w", err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// CreateToken creates the policy and a token of it. Creating the policy is
+// retried until the acl system is ready after the leader election, the token
+// is only created once so a failed attempt doesn't leave tokens behind.
+func CreateToken(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, managementToken string, name string, rules string, timeout time.Duration) (string, error) {
+	err := wait.For(ctx, fmt.Sprintf("consul %s policy", name), timeout, func(ctx context.Context) (bool, error) {
+		// the policy of an earlier attempt is reused
+		if _, err := runtime.Exec(ctx, node, consulCmd(managementToken, []string{"acl", "policy", "read"}, "-name", name)); err == nil {
+			return true, nil
+		}
+
+		_, err := runtime.Exec(ctx, node, consulCmd(managementToken, []string{"acl", "policy", "create"}, "-name", name, "-rules", rules))
+
+		return err == nil, err
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("unable to create consul %s policy: %w", name, err)
+	}
+
+	respText, err := runtime.Exec(ctx, node, consulCmd(managementToken, []string{"acl", "token", "create"},
+		"-description", fmt.Sprintf("n3d %s", name), "-policy-name", name, "-format", "json"))
+
+	if err != nil {
+		return "", fmt.Errorf("unable to create consul %s token: %w", name, err)
+	}
+
+	resp := &aclTokenResponse{}
+	if err := json.Unmarshal([]byte(*respText), resp); err != nil || resp.SecretID == "" {
+		return "", fmt.Errorf("unable to parse consul %s token response of %d bytes", name, len(*respText))
+	}
+
+	return resp.SecretID, nil
+}
+
+// consulCmd builds a consul cli command, the acl token flag has to precede the arguments.
+func consulCmd(token string, subcommand []string, args ...string) []string {
+	cmd := append([]string{"consul"}, subcommand...)
+
+	if token != "" {
+		cmd = append(cmd, fmt.Sprintf("-token=%s", token))
+	}
+
+	return append(cmd, args...)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"n3d/constants"
 	"n3d/runtimes"
+	"strings"
 
 	"github.com/docker/go-connections/nat"
 	"gopkg.in/yaml.v3"
@@ -31,16 +32,25 @@ type LoadBalancerCreateOptions struct {
 	NetworkName  string
 	PortMappings []*PortMapping
 	ClusterName  string
+	Labels       map[string]string
+	// Image overrides DefaultLBImage.
+	Image string
+}
+
+func NodeName(clusterName string) string {
+	return fmt.Sprintf("%s-default-lb", clusterName)
 }
 
 type PortMapping struct {
 	Port    nat.Port
 	Proto   string
 	Servers []string
+	// HostPort the port is published on, defaults to the port itself.
+	HostPort string
 }
 
 func NewLoadBalancer(ctx context.Context, runtime runtimes.Runtime, opts LoadBalancerCreateOptions) (*runtimes.Node, error) {
-	nodeName := fmt.Sprintf("%s-default-lb", opts.ClusterName)
+	nodeName := NodeName(opts.ClusterName)
 	lbConfig := convertToProxyConfig(&opts)
 
 	configYaml, err := yaml.Marshal(lbConfig)
@@ -51,19 +61,40 @@ func NewLoadBalancer(ctx context.Context, runtime runtimes.Runtime, opts LoadBal
 	portsToExpose := make(map[nat.Port][]nat.PortBinding, 0)
 	//"4646/tcp:4646"
 	for _, v := range opts.PortMappings {
+		hostPort := v.HostPort
+		if hostPort == "" {
+			hostPort = string(v.Port)
+		}
+
 		if _, exists := portsToExpose[v.Port]; !exists {
 			portsToExpose[v.Port] = []nat.PortBinding{
 				{
 					HostIP:   "0.0.0.0",
-					HostPort: string(v.Port),
+					HostPort: hostPort,
 				},
 			}
 		}
 	}
 
+	image := opts.Image
+	if image == "" {
+		image = DefaultLBImage
+	}
+
+	labels := map[string]string{
+		constants.NodeName:    nodeName,
+		constants.ClusterName: opts.ClusterName,
+		constants.NodeType:    constants.LoadBalancer,
+		constants.Image:       image,
+	}
+
+	for k, v := range opts.Labels {
+		labels[k] = v
+	}
+
 	nodeConf := runtimes.NodeConfig{
 		Name:        nodeName,
-		Image:       DefaultLBImage,
+		Image:       image,
 		NetworkName: opts.NetworkName,
 		Files: []*runtimes.FileInNode{
 			{
@@ -72,12 +103,8 @@ func NewLoadBalancer(ctx context.Context, runtime runtimes.Runtime, opts LoadBal
 				FileMode: 0644,
 			},
 		},
-		Ports: portsToExpose,
-		Labels: map[string]string{
-			constants.NodeName:    nodeName,
-			constants.ClusterName: opts.ClusterName,
-			constants.NodeType:    constants.LoadBalancer,
-		},
+		Ports:  portsToExpose,
+		Labels: labels,
 	}
 
 	node, err := runtime.RunNode(ctx, nodeConf)
@@ -89,9 +116,75 @@ func NewLoadBalancer(ctx context.Context, runtime runtimes.Runtime, opts LoadBal
 	return node, nil
 }
 
+// ReadConfig returns the proxy config of the load balancer.
+func ReadConfig(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node) ([]byte, error) {
+	return runtime.ReadFile(ctx, node, defaultLoadbalancerConfigPath)
+}
+
+// Recreate runs a removed load balancer again with its labels, published
+// ports and proxy config.
+func Recreate(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, networkName string, config []byte) (*runtimes.Node, error) {
+	ports := make(map[nat.Port][]nat.PortBinding)
+
+	for k, v := range node.Labels {
+		if !strings.HasPrefix(k, constants.HostPortLabelPrefix) {
+			continue
+		}
+
+		port := nat.Port(strings.TrimPrefix(k, constants.HostPortLabelPrefix) + "/tcp")
+		ports[port] = []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: v}}
+	}
+
+	return runtime.RunNode(ctx, runtimes.NodeConfig{
+		Name:        node.Name,
+		Image:       node.Labels[constants.Image],
+		NetworkName: networkName,
+		Files: []*runtimes.FileInNode{
+			{
+				Content:  config,
+				Path:     defaultLoadbalancerConfigPath,
+				FileMode: 0644,
+			},
+		},
+		Ports:  ports,
+		Labels: node.Labels,
+	})
+}
+
+// UpdateLoadBalancer rewrites the proxy config of a running load balancer,
+// the proxy watches its config file and reloads itself on change.
+func UpdateLoadBalancer(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, portMappings []*PortMapping) error {
+	lbConfig := convertToProxyConfig(&LoadBalancerCreateOptions{
+		PortMappings: portMappings,
+	})
+
+	configYaml, err := yaml.Marshal(lbConfig)
+	if err != nil {
+		return fmt.Errorf("failed to marshal loadbalancer config: %w", err)
+	}
+
+	err = runtime.WriteFile(ctx, node, &runtimes.FileInNode{
+		Content:  configYaml,
+		Path:     defaultLoadbalancerConfigPath,
+		FileMode: 0644,
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to update load balancer config: %w", err)
+	}
+
+	return nil
+}
+
 func convertToProxyConfig(opts *LoadBalancerCreateOptions) *loadbalancerConfig {
 	ports := make(map[string][]string)
 	for _, v := range opts.PortMappings {
+		// the proxy can't serve a port without upstream servers, the port
+		// stays published and is served once servers are added
+		if len(v.Servers) == 0 {
+			continue
+		}
+
 		ports[fmt.Sprintf("%s.%s", v.Port, v.Proto)] = v.Servers
 	}
 
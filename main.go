@@ -2,6 +2,7 @@ package main
 
 import (
 	"n3d/cmd"
+	"os"
 
 	"github.com/sirupsen/logrus"
 )
@@ -13,5 +14,6 @@ func main() {
 
 	if err != nil {
 		logrus.Error(err)
+		os.Exit(1)
 	}
 }
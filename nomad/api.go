@@ -0,0 +1,261 @@
+package nomad
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrorAPI = errors.New("nomad api request failed")
+
+// APIClient talks to the nomad http api from the host, through the load balancer.
+type APIClient struct {
+	address string
+	token   string
+	client  *http.Client
+}
+
+// NewAPIClient creates a client of the api at address, caFile is the CA the
+// api certificate is verified with when the cluster uses tls.
+func NewAPIClient(address string, token string, caFile string) (*APIClient, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ca certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &APIClient{
+		address: address,
+		token:   token,
+		client:  &http.Client{Transport: transport, Timeout: time.Minute},
+	}, nil
+}
+
+// Job is kept as raw json, n3d only reads the fields it needs and passes the
+// rest back to nomad unchanged.
+type Job = json.RawMessage
+
+// JobRef identifies a job, an empty namespace is the default namespace.
+type JobRef struct {
+	ID        string `json:"ID"`
+	Namespace string `json:"Namespace"`
+}
+
+// ReadJobRef returns the id and namespace of a parsed job.
+func ReadJobRef(job Job) (*JobRef, error) {
+	ref := &JobRef{}
+	if err := json.Unmarshal(job, ref); err != nil || ref.ID == "" {
+		return nil, errors.New("job has no id")
+	}
+
+	return ref, nil
+}
+
+type FieldDiff struct {
+	Type string `json:"Type"`
+	Name string `json:"Name"`
+	Old  string `json:"Old"`
+	New  string `json:"New"`
+}
+
+type ObjectDiff struct {
+	Type    string        `json:"Type"`
+	Name    string        `json:"Name"`
+	Fields  []*FieldDiff  `json:"Fields"`
+	Objects []*ObjectDiff `json:"Objects"`
+}
+
+type TaskDiff struct {
+	Type        string        `json:"Type"`
+	Name        string        `json:"Name"`
+	Fields      []*FieldDiff  `json:"Fields"`
+	Objects     []*ObjectDiff `json:"Objects"`
+	Annotations []string      `json:"Annotations"`
+}
+
+type TaskGroupDiff struct {
+	Type    string            `json:"Type"`
+	Name    string            `json:"Name"`
+	Fields  []*FieldDiff      `json:"Fields"`
+	Objects []*ObjectDiff     `json:"Objects"`
+	Tasks   []*TaskDiff       `json:"Tasks"`
+	Updates map[string]uint64 `json:"Updates"`
+}
+
+type JobDiff struct {
+	Type       string           `json:"Type"`
+	ID         string           `json:"ID"`
+	Fields     []*FieldDiff     `json:"Fields"`
+	Objects    []*ObjectDiff    `json:"Objects"`
+	TaskGroups []*TaskGroupDiff `json:"TaskGroups"`
+}
+
+// AllocationMetric explains why allocations of a task group couldn't be placed.
+type AllocationMetric struct {
+	NodesEvaluated     int            `json:"NodesEvaluated"`
+	NodesExhausted     int            `json:"NodesExhausted"`
+	ConstraintFiltered map[string]int `json:"ConstraintFiltered"`
+	DimensionExhausted map[string]int `json:"DimensionExhausted"`
+	CoalescedFailures  int            `json:"CoalescedFailures"`
+}
+
+type PlanResponse struct {
+	JobModifyIndex uint64                       `json:"JobModifyIndex"`
+	Diff           *JobDiff                     `json:"Diff"`
+	FailedTGAllocs map[string]*AllocationMetric `json:"FailedTGAllocs"`
+	Warnings       string                       `json:"Warnings"`
+}
+
+type RegisterResponse struct {
+	EvalID   string `json:"EvalID"`
+	Warnings string `json:"Warnings"`
+}
+
+type Evaluation struct {
+	ID                string                       `json:"ID"`
+	Status            string                       `json:"Status"`
+	StatusDescription string                       `json:"StatusDescription"`
+	DeploymentID      string                       `json:"DeploymentID"`
+	FailedTGAllocs    map[string]*AllocationMetric `json:"FailedTGAllocs"`
+}
+
+type Deployment struct {
+	ID                string `json:"ID"`
+	Status            string `json:"Status"`
+	StatusDescription string `json:"StatusDescription"`
+}
+
+// ParseJob converts an hcl jobspec to the json job of the api.
+func (c *APIClient) ParseJob(ctx context.Context, hcl string) (Job, error) {
+	job := Job{}
+	err := c.do(ctx, http.MethodPost, "/v1/jobs/parse", map[string]interface{}{
+		"JobHCL":       hcl,
+		"Canonicalize": true,
+	}, &job)
+
+	return job, err
+}
+
+func (c *APIClient) PlanJob(ctx context.Context, ref *JobRef, job Job) (*PlanResponse, error) {
+	resp := &PlanResponse{}
+	err := c.do(ctx, http.MethodPost, withNamespace("/v1/job/"+url.PathEscape(ref.ID)+"/plan", ref.Namespace), map[string]interface{}{
+		"Job":  job,
+		"Diff": true,
+	}, resp)
+
+	return resp, err
+}
+
+func (c *APIClient) RegisterJob(ctx context.Context, ref *JobRef, job Job) (*RegisterResponse, error) {
+	resp := &RegisterResponse{}
+	err := c.do(ctx, http.MethodPost, withNamespace("/v1/jobs", ref.Namespace), map[string]interface{}{"Job": job}, resp)
+
+	return resp, err
+}
+
+// StopJob deregisters the job, purge removes it from the job list as well.
+func (c *APIClient) StopJob(ctx context.Context, ref *JobRef, purge bool) (string, error) {
+	resp := &RegisterResponse{}
+	path := fmt.Sprintf("/v1/job/%s?purge=%t", url.PathEscape(ref.ID), purge)
+	err := c.do(ctx, http.MethodDelete, withNamespace(path, ref.Namespace), nil, resp)
+
+	return resp.EvalID, err
+}
+
+func (c *APIClient) Evaluation(ctx context.Context, namespace string, id string) (*Evaluation, error) {
+	eval := &Evaluation{}
+	err := c.do(ctx, http.MethodGet, withNamespace("/v1/evaluation/"+url.PathEscape(id), namespace), nil, eval)
+
+	return eval, err
+}
+
+func (c *APIClient) Deployment(ctx context.Context, namespace string, id string) (*Deployment, error) {
+	deployment := &Deployment{}
+	err := c.do(ctx, http.MethodGet, withNamespace("/v1/deployment/"+url.PathEscape(id), namespace), nil, deployment)
+
+	return deployment, err
+}
+
+// withNamespace scopes the request to the namespace, nomad uses the default
+// namespace when none is given.
+func withNamespace(path string, namespace string) string {
+	if namespace == "" {
+		return path
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	return path + sep + "namespace=" + url.QueryEscape(namespace)
+}
+
+func (c *APIClient) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+
+	if body != nil {
+		content, err := json.Marshal(body)
+
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.address+path, reader)
+
+	if err != nil {
+		return err
+	}
+
+	if c.token != "" {
+		req.Header.Set("X-Nomad-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+
+	if err != nil {
+		return errors.Join(ErrorAPI, err)
+	}
+
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return errors.Join(ErrorAPI, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s %s: %s: %s", ErrorAPI, method, path, resp.Status, bytes.TrimSpace(content))
+	}
+
+	if err := json.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("unable to parse nomad response of %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -1,35 +1,211 @@
 package nomad
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"n3d/certs"
 	"n3d/constants"
 	"n3d/runtimes"
+	"n3d/wait"
+	"net"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	nomadServerImage = "multani/nomad:1.6.3"
-	nomadClientImage = "mahammadagayev/nomad-client:1.6.3"
+	DefaultVersion   = "1.6.3"
+	drainDeadline    = "1m"
+	drainTimeout     = 2 * time.Minute
+	snapshotPath     = "/tmp/n3d-nomad.snap"
+	dockerDaemonPath = "/etc/docker/daemon.json"
 )
 
+// DockerDaemonConfig holds the settings of the docker daemon running inside the nomad clients.
+type DockerDaemonConfig struct {
+	InsecureRegistries []string
+	RegistryMirrors    []string
+	// LocalRegistry is the host:port of a registry which is reachable on
+	// localhost:port as well, so images pushed to localhost from the host are
+	// pulled with the same name.
+	LocalRegistry string
+}
+
 type NomadConfiguration struct {
 	NetworkName string
 	ClusterName string
 	ConsulAddr  string
+	ConsulToken string
 	VaultAddr   string
+	// VaultToken and VaultRole are used by the servers to derive the vault tokens of the jobs.
 	VaultToken  string
+	VaultRole   string
 	Id          int
+	ServerCount int
 	ExtraCerts  []string
+	Docker      DockerDaemonConfig
+	Version     string
+	// Image overrides the image of the version.
+	Image string
+	ACL   bool
+	// TLS enables tls for http and rpc, consul and vault are reached over https.
+	TLS *certs.NodeCerts
+	// GossipKey encrypts the serf traffic of the servers.
+	GossipKey string
+	// WorkloadIdentity makes jobs log in to vault with their workload identity
+	// instead of tokens derived by the servers, it requires nomad 1.7.
+	WorkloadIdentity bool
+	VaultAudience    string
+}
+
+func ServerImage(version string) string {
+	return fmt.Sprintf("multani/nomad:%s", version)
+}
+
+func ClientImage(version string) string {
+	return fmt.Sprintf("mahammadagayev/nomad-client:%s", version)
+}
+
+// version returns the version and image of the node, the version defaults to
+// DefaultVersion unless the image is overridden.
+func (c NomadConfiguration) version(image func(string) string) (string, string) {
+	if c.Image != "" {
+		return c.Version, c.Image
+	}
+
+	if c.Version == "" {
+		return DefaultVersion, image(DefaultVersion)
+	}
+
+	return c.Version, image(c.Version)
+}
+
+func (c NomadConfiguration) aclConfig() string {
+	if !c.ACL {
+		return ""
+	}
+
+	return `
+	acl {
+		enabled = true
+	}
+	`
+}
+
+func (c NomadConfiguration) tlsConfig() string {
+	if c.TLS == nil {
+		return ""
+	}
+
+	return fmt.Sprintf(`
+	tls {
+		http = true
+		rpc  = true
+
+		ca_file   = "%s"
+		cert_file = "%s"
+		key_file  = "%s"
+
+		verify_server_hostname = true
+		verify_https_client    = false
+	}
+	`, certs.CAPath, certs.CertPath, certs.KeyPath)
+}
+
+// consulTLS and vaultTLS are the fields of the consul and vault blocks, both are served over https with tls.
+func (c NomadConfiguration) consulTLS() string {
+	if c.TLS == nil {
+		return ""
+	}
+
+	return fmt.Sprintf(`ssl     = true
+		ca_file = "%s"`, certs.CAPath)
+}
+
+// serverVault returns the vault integration fields of the servers.
+func (c NomadConfiguration) serverVault() string {
+	if !c.WorkloadIdentity {
+		return fmt.Sprintf(`token            = "%s"
+			create_from_role = "%s"`, c.VaultToken, c.VaultRole)
+	}
+
+	return fmt.Sprintf(`default_identity {
+				aud = ["%s"]
+				ttl = "1h"
+			}`, c.VaultAudience)
+}
+
+func (c NomadConfiguration) vaultTLS() string {
+	if c.TLS == nil {
+		return ""
+	}
+
+	return fmt.Sprintf(`ca_file = "%s"`, certs.CAPath)
+}
+
+// node returns the environment, files and labels shared by servers and clients.
+func (c NomadConfiguration) node(nodeType string, nomadConfig string, version string, image string) ([]string, []*runtimes.FileInNode, map[string]string) {
+	env := []string{fmt.Sprintf("NOMAD_LOCAL_CONFIG=%s", nomadConfig)}
+	files := []*runtimes.FileInNode{}
+	labels := map[string]string{
+		constants.NodeType:    nodeType,
+		constants.ClusterName: c.ClusterName,
+		constants.Version:     version,
+		constants.Image:       image,
+	}
+
+	if c.TLS != nil {
+		// the cli inside the node reads its address from the environment
+		env = append(env, "NOMAD_ADDR=https://127.0.0.1:4646", "NOMAD_CACERT="+certs.CAPath)
+		files = c.TLS.Files()
+		labels[constants.TLS] = "true"
+	}
+
+	return env, files, labels
+}
+
+func ServerName(clusterName string, id int) string {
+	return fmt.Sprintf("%s-nomad-server-%d", clusterName, id)
+}
+
+// ServiceName is the network alias shared by the nomad servers, it resolves
+// to the running servers.
+func ServiceName(clusterName string) string {
+	return fmt.Sprintf("%s-nomad", clusterName)
+}
+
+func ClientName(clusterName string, id int) string {
+	return fmt.Sprintf("%s-nomad-client-%d", clusterName, id)
 }
 
 func NewNomadServer(ctx context.Context, runtime runtimes.Runtime, config NomadConfiguration) (*runtimes.Node, error) {
-	nodeName := fmt.Sprintf("%s-nomad-server-%d", config.ClusterName, config.Id)
+	nodeName := ServerName(config.ClusterName, config.Id)
+	version, image := config.version(ServerImage)
+
+	serverCount := config.ServerCount
+	if serverCount < 1 {
+		serverCount = 1
+	}
+
+	retryJoin := make([]string, 0, serverCount)
+	for i := 0; i < serverCount; i++ {
+		retryJoin = append(retryJoin, fmt.Sprintf("%q", ServerName(config.ClusterName, i)))
+	}
+
 	nomadConfig := `
 	    server {
 	    	enabled = true
-	    	bootstrap_expect = 1
+	    	bootstrap_expect = %d
+
+	    	server_join {
+	    		retry_join = [%s]
+	    	}
+	    	%s
 	      }
 
 	      data_dir = "/nomad/data/"
@@ -38,16 +214,29 @@ func NewNomadServer(ctx context.Context, runtime runtimes.Runtime, config NomadC
 
 		consul { 
 			address = "%s"
+			token   = "%s"
+			%s
 		}
 
 		vault {
-			enabled = true
-			address =  "%s"
-			token   =  "%s"
+			enabled          = true
+			address          = "%s"
+			%s
+			%s
 		}
 	    `
 
-	nomadConfig = fmt.Sprintf(nomadConfig, config.ConsulAddr, config.VaultAddr, config.VaultToken)
+	encrypt := ""
+	if config.GossipKey != "" {
+		encrypt = fmt.Sprintf("encrypt = %q", config.GossipKey)
+	}
+
+	nomadConfig = fmt.Sprintf(nomadConfig, serverCount, strings.Join(retryJoin, ", "), encrypt, config.ConsulAddr, config.ConsulToken, config.consulTLS(),
+		config.VaultAddr, config.serverVault(), config.vaultTLS())
+	nomadConfig += config.aclConfig()
+	nomadConfig += config.tlsConfig()
+
+	env, files, labels := config.node(constants.NomadServer, nomadConfig, version, image)
 
 	volName := fmt.Sprintf("%s-nomad-server-vol-%d", config.ClusterName, config.Id)
 	runtime.CreateVolume(ctx, volName, map[string]string{
@@ -58,10 +247,11 @@ func NewNomadServer(ctx context.Context, runtime runtimes.Runtime, config NomadC
 
 	ctn, err := runtime.RunNode(ctx, runtimes.NodeConfig{
 		Name:        nodeName,
-		Image:       nomadServerImage,
+		Image:       image,
 		NetworkName: config.NetworkName,
 		Cmd:         []string{"agent"},
-		Env:         []string{fmt.Sprintf("NOMAD_LOCAL_CONFIG=%s", nomadConfig)},
+		Env:         env,
+		Files:       files,
 		Volumes: []*runtimes.Volume{
 			{
 				Name:   volName,
@@ -69,11 +259,9 @@ func NewNomadServer(ctx context.Context, runtime runtimes.Runtime, config NomadC
 				IsBind: false,
 			},
 		},
-		Labels: map[string]string{
-			constants.NodeType:    constants.NomadServer,
-			constants.ClusterName: config.ClusterName,
-		},
-		ExtraCerts: config.ExtraCerts,
+		Labels:         labels,
+		ExtraCerts:     config.ExtraCerts,
+		NetworkAliases: []string{ServiceName(config.ClusterName)},
 	})
 
 	if err != nil {
@@ -88,7 +276,8 @@ func NewNomadServer(ctx context.Context, runtime runtimes.Runtime, config NomadC
 }
 
 func NewNomadClient(ctx context.Context, runtime runtimes.Runtime, config NomadConfiguration) (*runtimes.Node, error) {
-	nodeName := fmt.Sprintf("%s-nomad-client-%d", config.ClusterName, config.Id)
+	nodeName := ClientName(config.ClusterName, config.Id)
+	version, image := config.version(ClientImage)
 
 	nomadConfig := `
 	client {
@@ -105,28 +294,40 @@ func NewNomadClient(ctx context.Context, runtime runtimes.Runtime, config NomadC
 	  data_dir = "/nomad/data/"
 	  consul { 
 		address = "%s"
+		token   = "%s"
+		%s
 	  }	  
 	  vault {
 		enabled = true
 		address = "%s"
-		token   = "%s"
+		%s
 	  }	  
 	`
-	nomadConfig = fmt.Sprintf(nomadConfig, nodeName, nodeName, nodeName, config.ConsulAddr, config.VaultAddr, config.VaultToken)
+	nomadConfig = fmt.Sprintf(nomadConfig, nodeName, nodeName, nodeName, config.ConsulAddr, config.ConsulToken, config.consulTLS(), config.VaultAddr, config.vaultTLS())
+	nomadConfig += config.aclConfig()
+	nomadConfig += config.tlsConfig()
+
+	env, files, labels := config.node(constants.NomadClient, nomadConfig, version, image)
+
+	daemonConfig, err := mergeDockerDaemonConfig(nil, config.Docker)
+
+	if err != nil {
+		return nil, err
+	}
 
 	volName := fmt.Sprintf("%s-nomad-client-vol-%d", config.ClusterName, config.Id)
 	runtime.CreateVolume(ctx, volName, map[string]string{
 		constants.ClusterName: config.ClusterName,
 		constants.VolumeType:  constants.NomadClient,
-		constants.NodeName:    constants.NodeName,
+		constants.NodeName:    nodeName,
 	})
 
 	ctn, err := runtime.RunNode(ctx, runtimes.NodeConfig{
 		Name:        nodeName,
-		Image:       nomadClientImage,
+		Image:       image,
 		NetworkName: config.NetworkName,
 		Cmd:         []string{"agent"},
-		Env:         []string{fmt.Sprintf("NOMAD_LOCAL_CONFIG=%s", nomadConfig)},
+		Env:         env,
 		Privileged:  true,
 		TmpFs: []string{
 			"/var/run",
@@ -139,16 +340,346 @@ func NewNomadClient(ctx context.Context, runtime runtimes.Runtime, config NomadC
 				IsBind: false,
 			},
 		},
-		Labels: map[string]string{
-			constants.NodeType:    constants.NomadClient,
-			constants.ClusterName: config.ClusterName,
-		},
+		Labels:     labels,
 		ExtraCerts: config.ExtraCerts,
+		Files: append(files, &runtimes.FileInNode{
+			Content:  daemonConfig,
+			Path:     dockerDaemonPath,
+			FileMode: 0644,
+		}),
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	if config.Docker.LocalRegistry != "" {
+		if err := ForwardLocalRegistry(ctx, runtime, ctn, config.Docker.LocalRegistry); err != nil {
+			return nil, err
+		}
+	}
+
 	return ctn, nil
 }
+
+// forwardRegistryScript makes connections of the node to 127.0.0.1:port reach
+// the registry, the docker daemon trusts registries on localhost by default.
+// The chains are replaced on every run, since the registry ip may change.
+const forwardRegistryScript = `set -e
+ip=$(getent ahostsv4 %[1]s | head -n1 | cut -d' ' -f1)
+[ -n "$ip" ]
+echo 1 > /proc/sys/net/ipv4/conf/all/route_localnet
+iptables -t nat -N N3D-REGISTRY 2>/dev/null || iptables -t nat -F N3D-REGISTRY
+iptables -t nat -A N3D-REGISTRY -d 127.0.0.1/32 -p tcp --dport %[2]s -j DNAT --to-destination "$ip:%[2]s"
+iptables -t nat -C OUTPUT -j N3D-REGISTRY 2>/dev/null || iptables -t nat -I OUTPUT -j N3D-REGISTRY
+iptables -t nat -N N3D-REGISTRY-SNAT 2>/dev/null || iptables -t nat -F N3D-REGISTRY-SNAT
+iptables -t nat -A N3D-REGISTRY-SNAT -s 127.0.0.1/32 -d "$ip/32" -p tcp --dport %[2]s -j MASQUERADE
+iptables -t nat -C POSTROUTING -j N3D-REGISTRY-SNAT 2>/dev/null || iptables -t nat -I POSTROUTING -j N3D-REGISTRY-SNAT
+`
+
+// ForwardLocalRegistry makes localhost:port of the nomad client reach the
+// registry at address, the forwarding is lost when the node restarts.
+func ForwardLocalRegistry(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, address string) error {
+	host, port, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return fmt.Errorf("invalid registry address %q: %w", address, err)
+	}
+
+	if _, err := runtime.Exec(ctx, node, []string{"sh", "-c", fmt.Sprintf(forwardRegistryScript, host, port)}); err != nil {
+		return fmt.Errorf("unable to forward localhost:%s of node %s to the registry: %w", port, node.Name, err)
+	}
+
+	return nil
+}
+
+// ConfigureDocker merges the settings into the daemon.json of a nomad client
+// and makes its docker daemon reload them.
+func ConfigureDocker(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, docker DockerDaemonConfig) error {
+	// a missing file is the same as an empty config
+	current, _ := runtime.ReadFile(ctx, node, dockerDaemonPath)
+
+	daemonConfig, err := mergeDockerDaemonConfig(current, docker)
+
+	if err != nil {
+		return fmt.Errorf("unable to configure docker of node %s: %w", node.Name, err)
+	}
+
+	err = runtime.WriteFile(ctx, node, &runtimes.FileInNode{
+		Content:  daemonConfig,
+		Path:     dockerDaemonPath,
+		FileMode: 0644,
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to configure docker of node %s: %w", node.Name, err)
+	}
+
+	// a stopped node reads the file when it starts
+	if !node.IsRunning() {
+		return nil
+	}
+
+	if _, err := runtime.Exec(ctx, node, []string{"sh", "-c", "kill -HUP $(pidof dockerd)"}); err != nil {
+		return fmt.Errorf("unable to reload docker of node %s: %w", node.Name, err)
+	}
+
+	if docker.LocalRegistry != "" {
+		return ForwardLocalRegistry(ctx, runtime, node, docker.LocalRegistry)
+	}
+
+	return nil
+}
+
+// mergeDockerDaemonConfig adds the settings to the given daemon.json content,
+// keeping the settings n3d doesn't manage.
+func mergeDockerDaemonConfig(current []byte, docker DockerDaemonConfig) ([]byte, error) {
+	daemonConfig := make(map[string]interface{})
+
+	if len(bytes.TrimSpace(current)) > 0 {
+		if err := json.Unmarshal(current, &daemonConfig); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", dockerDaemonPath, err)
+		}
+	}
+
+	addToList(daemonConfig, "insecure-registries", docker.InsecureRegistries)
+	addToList(daemonConfig, "registry-mirrors", docker.RegistryMirrors)
+
+	return json.MarshalIndent(daemonConfig, "", "  ")
+}
+
+func addToList(daemonConfig map[string]interface{}, key string, values []string) {
+	list, _ := daemonConfig[key].([]interface{})
+
+	for _, v := range values {
+		found := false
+
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			list = append(list, v)
+		}
+	}
+
+	if len(list) > 0 {
+		daemonConfig[key] = list
+	}
+}
+
+// DrainNode drains the nomad client through the API of its local agent and
+// waits until the drain is complete, allocations left after the deadline are
+// stopped by nomad.
+func DrainNode(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, token string) error {
+	cmd := nomadCmd(token, []string{"node", "drain"}, "-self", "-enable", "-yes", "-detach", "-deadline", drainDeadline)
+
+	out, err := runtime.Exec(ctx, node, cmd)
+
+	if err != nil {
+		return fmt.Errorf("unable to drain node %s: %w", node.Name, err)
+	}
+
+	log.WithContext(ctx).WithField("name", node.Name).Debug(*out)
+
+	err = wait.For(ctx, "nomad node drain", drainTimeout, func(ctx context.Context) (bool, error) {
+		out, err := runtime.Exec(ctx, node, nomadCmd(token, []string{"node", "status"}, "-self", "-json"))
+
+		if err != nil {
+			return false, err
+		}
+
+		status := nodeDrainStatus{}
+		if err := json.Unmarshal([]byte(*out), &status); err != nil {
+			return false, fmt.Errorf("unable to parse nomad node status: %q: %w", *out, err)
+		}
+
+		return status.DrainStrategy == nil, nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to drain node %s: %w", node.Name, err)
+	}
+
+	return nil
+}
+
+type nodeDrainStatus struct {
+	// DrainStrategy is cleared by nomad once the drain is complete.
+	DrainStrategy *json.RawMessage `json:"DrainStrategy"`
+}
+
+// LoadImages loads a docker save archive into the docker daemon of the nomad client.
+func LoadImages(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, archive io.Reader) error {
+	out, err := runtime.ExecWithInput(ctx, node, []string{"docker", "load"}, archive)
+
+	if err != nil {
+		return fmt.Errorf("unable to load images into node %s: %w", node.Name, err)
+	}
+
+	log.WithContext(ctx).WithField("name", node.Name).Debug(*out)
+
+	return nil
+}
+
+type nodeListStub struct {
+	Name   string `json:"Name"`
+	Status string `json:"Status"`
+}
+
+// Leader returns the raft leader known by the nomad server, it is empty while there's no leader.
+func Leader(ctx context.Context, runtime runtimes.Runtime, server *runtimes.Node) (string, error) {
+	respText, err := runtime.Exec(ctx, server, []string{"nomad", "operator", "api", "/v1/status/leader"})
+
+	if err != nil {
+		return "", err
+	}
+
+	leader := ""
+	if err := json.Unmarshal([]byte(*respText), &leader); err != nil {
+		return "", fmt.Errorf("unable to parse nomad leader: %q: %w", *respText, err)
+	}
+
+	return leader, nil
+}
+
+// ReadyClients returns the count of nomad clients registered as ready.
+func ReadyClients(ctx context.Context, runtime runtimes.Runtime, server *runtimes.Node, token string) (int, error) {
+	respText, err := runtime.Exec(ctx, server, nomadCmd(token, []string{"operator", "api"}, "/v1/nodes"))
+
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := make([]nodeListStub, 0)
+	if err := json.Unmarshal([]byte(*respText), &nodes); err != nil {
+		return 0, fmt.Errorf("unable to parse nomad nodes: %q: %w", *respText, err)
+	}
+
+	ready := 0
+	for _, n := range nodes {
+		if n.Status == "ready" {
+			ready++
+		}
+	}
+
+	return ready, nil
+}
+
+func WaitForLeader(ctx context.Context, runtime runtimes.Runtime, server *runtimes.Node, timeout time.Duration) error {
+	return wait.For(ctx, "nomad leader", timeout, func(ctx context.Context) (bool, error) {
+		leader, err := Leader(ctx, runtime, server)
+
+		return leader != "", err
+	})
+}
+
+// WaitForClients waits until at least count nomad clients are registered as ready.
+func WaitForClients(ctx context.Context, runtime runtimes.Runtime, server *runtimes.Node, token string, count int, timeout time.Duration) error {
+	return wait.For(ctx, "nomad clients", timeout, func(ctx context.Context) (bool, error) {
+		ready, err := ReadyClients(ctx, runtime, server, token)
+
+		return ready >= count, err
+	})
+}
+
+// SnapshotSave takes a snapshot of the nomad raft state through the given server.
+func SnapshotSave(ctx context.Context, runtime runtimes.Runtime, server *runtimes.Node, token string) ([]byte, error) {
+	defer removeSnapshot(ctx, runtime, server)
+
+	removeSnapshot(ctx, runtime, server)
+
+	if _, err := runtime.Exec(ctx, server, nomadCmd(token, []string{"operator", "snapshot", "save"}, snapshotPath)); err != nil {
+		return nil, fmt.Errorf("unable to save nomad snapshot: %w", err)
+	}
+
+	return runtime.ReadFile(ctx, server, snapshotPath)
+}
+
+func SnapshotRestore(ctx context.Context, runtime runtimes.Runtime, server *runtimes.Node, token string, snapshot []byte) error {
+	defer removeSnapshot(ctx, runtime, server)
+
+	err := runtime.WriteFile(ctx, server, &runtimes.FileInNode{
+		Content:  snapshot,
+		Path:     snapshotPath,
+		FileMode: 0600,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	out, err := runtime.Exec(ctx, server, nomadCmd(token, []string{"operator", "snapshot", "restore"}, snapshotPath))
+
+	if err != nil {
+		return fmt.Errorf("unable to restore nomad snapshot: %w", err)
+	}
+
+	log.WithContext(ctx).WithField("name", server.Name).Debug(*out)
+
+	return nil
+}
+
+func removeSnapshot(ctx context.Context, runtime runtimes.Runtime, server *runtimes.Node) {
+	_, _ = runtime.Exec(ctx, server, []string{"rm", "-f", snapshotPath})
+}
+
+type aclTokenResponse struct {
+	SecretID string `json:"SecretID"`
+}
+
+var ErrorACLBootstrapped = errors.New("nomad acl is already bootstrapped")
+
+// ACLBootstrap creates the initial management token, it is retried until the
+// servers are able to serve it. ErrorACLBootstrapped is returned right away
+// when the acl system was bootstrapped before.
+func ACLBootstrap(ctx context.Context, runtime runtimes.Runtime, server *runtimes.Node, timeout time.Duration) (string, error) {
+	token := ""
+	bootstrapped := false
+
+	err := wait.For(ctx, "nomad acl bootstrap", timeout, func(ctx context.Context) (bool, error) {
+		respText, err := runtime.Exec(ctx, server, []string{"nomad", "acl", "bootstrap", "-json"})
+
+		if err != nil && strings.Contains(err.Error(), "ACL bootstrap already done") {
+			bootstrapped = true
+			return true, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		resp := &aclTokenResponse{}
+		if err := json.Unmarshal([]byte(*respText), resp); err != nil || resp.SecretID == "" {
+			return false, nil
+		}
+
+		token = resp.SecretID
+
+		return true, nil
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("unable to bootstrap nomad acl: %w", err)
+	}
+
+	if bootstrapped {
+		return "", ErrorACLBootstrapped
+	}
+
+	return token, nil
+}
+
+// nomadCmd builds a nomad cli command, the acl token flag has to precede the arguments.
+func nomadCmd(token string, subcommand []string, args ...string) []string {
+	cmd := append([]string{"nomad"}, subcommand...)
+
+	if token != "" {
+		cmd = append(cmd, fmt.Sprintf("-token=%s", token))
+	}
+
+	return append(cmd, args...)
+}
@@ -0,0 +1,81 @@
+package nomad
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergeDockerDaemonConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		docker  DockerDaemonConfig
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "empty config",
+			current: "",
+			docker:  DockerDaemonConfig{InsecureRegistries: []string{"c-registry.localhost:5000"}},
+			want:    `{"insecure-registries": ["c-registry.localhost:5000"]}`,
+		},
+		{
+			name:    "nothing to add",
+			current: "  \n",
+			want:    `{}`,
+		},
+		{
+			name:    "keeps other settings",
+			current: `{"log-level": "warn", "registry-mirrors": ["http://mirror:5000"]}`,
+			docker: DockerDaemonConfig{
+				InsecureRegistries: []string{"c-registry.localhost:5000"},
+				RegistryMirrors:    []string{"http://c-registry-mirror:5000"},
+			},
+			want: `{
+				"log-level": "warn",
+				"insecure-registries": ["c-registry.localhost:5000"],
+				"registry-mirrors": ["http://mirror:5000", "http://c-registry-mirror:5000"]
+			}`,
+		},
+		{
+			name:    "skips duplicates",
+			current: `{"insecure-registries": ["c-registry.localhost:5000"]}`,
+			docker:  DockerDaemonConfig{InsecureRegistries: []string{"c-registry.localhost:5000", "c-registry.localhost:5000"}},
+			want:    `{"insecure-registries": ["c-registry.localhost:5000"]}`,
+		},
+		{
+			name:    "invalid config",
+			current: `{"insecure-registries": `,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := mergeDockerDaemonConfig([]byte(tt.current), tt.docker)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeDockerDaemonConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			var got, want map[string]interface{}
+
+			if err := json.Unmarshal(merged, &got); err != nil {
+				t.Fatalf("invalid merged config %s: %v", merged, err)
+			}
+
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("mergeDockerDaemonConfig() = %s, want %s", merged, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"n3d/constants"
+	"n3d/runtimes"
+
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	imageName   = "registry:2"
+	DefaultPort = 5000
+)
+
+type RegistryConfiguration struct {
+	ClusterName string
+	NetworkName string
+	// Port is used on the host and inside the container, so the registry has
+	// the same address for pushes from the host and pulls from the workers.
+	Port int
+}
+
+// NodeName ends with .localhost, which resolves to the loopback on the host
+// and to the registry container on the cluster network.
+func NodeName(clusterName string) string {
+	return fmt.Sprintf("%s-registry.localhost", clusterName)
+}
+
+// Address returns host:port the registry is reachable on from the host and the
+// workers, which forward localhost:port to it as well.
+func Address(node *runtimes.Node) string {
+	return fmt.Sprintf("%s:%s", node.Name, node.Labels[constants.RegistryPort])
+}
+
+func NewRegistry(ctx context.Context, runtime runtimes.Runtime, config RegistryConfiguration) (*runtimes.Node, error) {
+	nodeName := NodeName(config.ClusterName)
+	volName := fmt.Sprintf("%s-registry-vol", config.ClusterName)
+
+	port := config.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+
+	runtime.CreateVolume(ctx, volName, map[string]string{
+		constants.ClusterName: config.ClusterName,
+		constants.VolumeType:  constants.Registry,
+		constants.NodeName:    nodeName,
+	})
+
+	containerPort := nat.Port(fmt.Sprintf("%d/tcp", port))
+
+	ctn, err := runtime.RunNode(ctx, runtimes.NodeConfig{
+		Image:       imageName,
+		Name:        nodeName,
+		NetworkName: config.NetworkName,
+		Env:         []string{fmt.Sprintf("REGISTRY_HTTP_ADDR=0.0.0.0:%d", port)},
+		Ports: map[nat.Port][]nat.PortBinding{
+			containerPort: {
+				{
+					HostIP:   "0.0.0.0",
+					HostPort: fmt.Sprint(port),
+				},
+			},
+		},
+		Volumes: []*runtimes.Volume{
+			{
+				Name:   volName,
+				Dest:   "/var/lib/registry",
+				IsBind: false,
+			},
+		},
+		Labels: map[string]string{
+			constants.NodeType:     constants.Registry,
+			constants.ClusterName:  config.ClusterName,
+			constants.NodeName:     nodeName,
+			constants.RegistryPort: fmt.Sprint(port),
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ctn, nil
+}
+
+const (
+	mirrorPort       = 5000
+	DefaultRemoteURL = "https://registry-1.docker.io"
+)
+
+type MirrorConfiguration struct {
+	ClusterName string
+	NetworkName string
+	RemoteURL   string
+}
+
+func MirrorName(clusterName string) string {
+	return fmt.Sprintf("%s-registry-mirror", clusterName)
+}
+
+// MirrorCacheVolume is not removed with the cluster when asked, so a recreated
+// cluster starts with the images pulled before.
+func MirrorCacheVolume(clusterName string) string {
+	return fmt.Sprintf("%s-registry-mirror-cache", clusterName)
+}
+
+// MirrorURL returns the url the docker daemons of the workers pull through.
+func MirrorURL(node *runtimes.Node) string {
+	return fmt.Sprintf("http://%s", MirrorAddress(node))
+}
+
+func MirrorAddress(node *runtimes.Node) string {
+	return fmt.Sprintf("%s:%d", node.Name, mirrorPort)
+}
+
+// NewMirror runs a pull through cache of the remote registry, it is only
+// reachable from the cluster network.
+func NewMirror(ctx context.Context, runtime runtimes.Runtime, config MirrorConfiguration) (*runtimes.Node, error) {
+	nodeName := MirrorName(config.ClusterName)
+	volName := MirrorCacheVolume(config.ClusterName)
+
+	remoteURL := config.RemoteURL
+	if remoteURL == "" {
+		remoteURL = DefaultRemoteURL
+	}
+
+	runtime.CreateVolume(ctx, volName, map[string]string{
+		constants.ClusterName: config.ClusterName,
+		constants.VolumeType:  constants.RegistryMirror,
+		constants.NodeName:    nodeName,
+	})
+
+	ctn, err := runtime.RunNode(ctx, runtimes.NodeConfig{
+		Image:       imageName,
+		Name:        nodeName,
+		NetworkName: config.NetworkName,
+		Env: []string{
+			fmt.Sprintf("REGISTRY_HTTP_ADDR=0.0.0.0:%d", mirrorPort),
+			fmt.Sprintf("REGISTRY_PROXY_REMOTEURL=%s", remoteURL),
+		},
+		Volumes: []*runtimes.Volume{
+			{
+				Name:   volName,
+				Dest:   "/var/lib/registry",
+				IsBind: false,
+			},
+		},
+		Labels: map[string]string{
+			constants.NodeType:    constants.RegistryMirror,
+			constants.ClusterName: config.ClusterName,
+			constants.NodeName:    nodeName,
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ctn, nil
+}
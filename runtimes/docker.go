@@ -9,15 +9,18 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	log "github.com/sirupsen/logrus"
@@ -69,14 +72,14 @@ func (d *DockerRuntime) CreateNetwork(ctx context.Context, name string, labels m
 	return nil
 }
 
-func (d *DockerRuntime) DeleteNetwork(ctx context.Context, id string, labels map[string]string) error {
-	err := d.cli.NetworkRemove(ctx, id)
+func (d *DockerRuntime) DeleteNetwork(ctx context.Context, name string) error {
+	err := d.cli.NetworkRemove(ctx, name)
 
 	if err != nil {
 		return err
 	}
 
-	log.WithContext(ctx).Info("network deleted")
+	log.WithContext(ctx).WithField("name", name).Info("network deleted")
 
 	return nil
 }
@@ -142,35 +145,28 @@ func (d *DockerRuntime) RunNode(ctx context.Context, node NodeConfig) (*Node, er
 			"image": config.Image,
 		}).Info("image do not exists, pulling....")
 
-		d.pullImage(ctx, node.Image)
-	}
-
-	resp, err := d.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, node.Name)
-	if err != nil {
-		return nil, err
+		if err := d.pullImage(ctx, node.Image); err != nil {
+			return nil, fmt.Errorf("unable to pull image %s: %w", node.Image, err)
+		}
 	}
 
-	if len(node.ExtraCerts) > 0 {
-		for _, v := range node.ExtraCerts {
-			err = d.copyToNode(ctx, resp.ID, v, "/etc/ssl/certs/")
-
-			if err != nil {
-				return nil, err
-			}
+	var networkingConfig *network.NetworkingConfig
+	if len(node.NetworkAliases) > 0 {
+		networkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				node.NetworkName: {Aliases: node.NetworkAliases},
+			},
 		}
 	}
 
-	if len(node.Files) > 0 {
-		for _, f := range node.Files {
-			err = d.writeToNode(ctx, f.Content, f.Path, f.FileMode, resp.ID)
-
-			if err != nil {
-				return nil, err
-			}
-		}
+	resp, err := d.cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, node.Name)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := d.cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+	if err := d.prepareAndStart(ctx, resp.ID, node); err != nil {
+		d.removeFailedNode(ctx, resp.ID, node.Name)
+
 		return nil, err
 	}
 
@@ -183,33 +179,86 @@ func (d *DockerRuntime) RunNode(ctx context.Context, node NodeConfig) (*Node, er
 
 	if err != nil {
 		log.WithError(err).WithField("id", resp.ID).Error("unable to get ip address for the container")
+		d.removeFailedNode(ctx, resp.ID, node.Name)
 
 		return nil, err
 	}
 
-	return &Node{Id: resp.ID, Name: node.Name, Ip: ipAddr}, nil
+	return &Node{Id: resp.ID, Name: node.Name, Ip: ipAddr, Labels: node.Labels, State: "running", Created: time.Now(), Ports: node.Ports}, nil
 }
 
-func (d *DockerRuntime) Logs(ctx context.Context, containerName string, wait bool) (io.ReadCloser, error) {
+func (d *DockerRuntime) prepareAndStart(ctx context.Context, id string, node NodeConfig) error {
+	for _, v := range node.ExtraCerts {
+		if err := d.copyToNode(ctx, id, v, "/etc/ssl/certs/"); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range node.Files {
+		if err := d.writeToNode(ctx, f.Content, f.Path, f.FileMode, id); err != nil {
+			return err
+		}
+	}
+
+	return d.cli.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
+
+// removeFailedNode removes a container which was created but couldn't be started,
+// it uses a fresh context since the failure may be caused by a cancelled one.
+func (d *DockerRuntime) removeFailedNode(ctx context.Context, id string, name string) {
+	err := d.cli.ContainerRemove(context.Background(), id, types.ContainerRemoveOptions{Force: true})
+
+	if err != nil {
+		log.WithContext(ctx).WithError(err).WithField("name", name).Warn("unable to remove failed container")
+	}
+}
+
+func (d *DockerRuntime) Logs(ctx context.Context, containerName string, opts LogsOptions, stdout io.Writer, stderr io.Writer) error {
+	info, err := d.cli.ContainerInspect(ctx, containerName)
+
+	if err != nil {
+		return err
+	}
+
 	reader, err := d.cli.ContainerLogs(ctx, containerName, types.ContainerLogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
-		Follow:     wait,
+		Follow:     opts.Follow,
+		Since:      opts.Since,
 	})
 
-	return reader, err
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	// logs of containers with a tty aren't multiplexed, stderr is part of stdout
+	if info.Config != nil && info.Config.Tty {
+		_, err = io.Copy(stdout, reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
 }
 
 func (d *DockerRuntime) pullImage(ctx context.Context, imageName string) error {
 
-	out, err := d.cli.ImagePull(context.Background(), imageName, types.ImagePullOptions{})
+	out, err := d.cli.ImagePull(ctx, imageName, types.ImagePullOptions{})
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	//enable in debug mode
-	//io.Copy(os.Stdout, out)
+	// the pull only completes once the progress stream is consumed
+	if err := jsonmessage.DisplayJSONMessagesStream(out, io.Discard, 0, false, nil); err != nil {
+		return err
+	}
 
 	log.WithContext(ctx).WithFields(log.Fields{
 		"name": imageName,
@@ -255,11 +304,7 @@ func (d *DockerRuntime) RemoveNode(ctx context.Context, node *Node) error {
 }
 
 func (d *DockerRuntime) GetNodesByLabel(ctx context.Context, labels map[string]string) ([]*Node, error) {
-	filters := filters.NewArgs()
-
-	for k, v := range labels {
-		filters.Add("label", fmt.Sprintf("%s=%s", k, v))
-	}
+	filters := labelFilters(labels)
 
 	containers, err := d.cli.ContainerList(ctx, types.ContainerListOptions{
 		Filters: filters,
@@ -273,11 +318,26 @@ func (d *DockerRuntime) GetNodesByLabel(ctx context.Context, labels map[string]s
 	nodes := make([]*Node, 0)
 
 	for _, v := range containers {
+		ports := make(map[nat.Port][]nat.PortBinding)
+		for _, p := range v.Ports {
+			if p.PublicPort == 0 {
+				continue
+			}
+
+			port := nat.Port(fmt.Sprintf("%d/%s", p.PrivatePort, p.Type))
+			ports[port] = append(ports[port], nat.PortBinding{
+				HostIP:   p.IP,
+				HostPort: fmt.Sprint(p.PublicPort),
+			})
+		}
 
 		node := &Node{
-			Name:   v.Names[0],
-			Id:     v.ID,
-			Labels: v.Labels,
+			Name:    strings.TrimPrefix(v.Names[0], "/"),
+			Id:      v.ID,
+			Labels:  v.Labels,
+			State:   v.State,
+			Created: time.Unix(v.Created, 0),
+			Ports:   ports,
 		}
 
 		nodes = append(nodes, node)
@@ -287,11 +347,7 @@ func (d *DockerRuntime) GetNodesByLabel(ctx context.Context, labels map[string]s
 }
 
 func (d *DockerRuntime) GetNetworksByLabel(ctx context.Context, labels map[string]string) ([]*Network, error) {
-	filters := filters.NewArgs()
-
-	for k, v := range labels {
-		filters.Add("label", fmt.Sprintf("%s=%s", k, v))
-	}
+	filters := labelFilters(labels)
 
 	networks, err := d.cli.NetworkList(ctx, types.NetworkListOptions{
 		Filters: filters,
@@ -334,11 +390,7 @@ func (d *DockerRuntime) CreateVolume(ctx context.Context, name string, labels ma
 }
 
 func (d *DockerRuntime) GetVolumesByLabel(ctx context.Context, labels map[string]string) ([]*Volume, error) {
-	filters := filters.NewArgs()
-
-	for k, v := range labels {
-		filters.Add("label", fmt.Sprintf("%s=%s", k, v))
-	}
+	filters := labelFilters(labels)
 
 	volumeResp, err := d.cli.VolumeList(ctx, volume.ListOptions{
 		Filters: filters,
@@ -366,10 +418,12 @@ func (d *DockerRuntime) GetVolumesByLabel(ctx context.Context, labels map[string
 	return n3dVolumes, nil
 }
 
+// Exec runs cmd and returns its stdout, a non-zero exit code is returned as
+// an error along with the output.
 func (d *DockerRuntime) Exec(ctx context.Context, node *Node, cmd []string) (*string, error) {
 	execConfig := types.ExecConfig{
 		Cmd:          cmd,
-		AttachStderr: false,
+		AttachStderr: true,
 		AttachStdout: true,
 		Tty:          false,
 	}
@@ -390,6 +444,16 @@ func (d *DockerRuntime) Exec(ctx context.Context, node *Node, cmd []string) (*st
 
 	defer resp.Close()
 
+	// the output is read before waiting, a command filling the pipe wouldn't exit otherwise
+	stdout := bytes.NewBuffer([]byte{})
+	stderr := bytes.NewBuffer([]byte{})
+
+	if _, err := stdcopy.StdCopy(stdout, stderr, resp.Reader); err != nil {
+		return nil, errors.Join(errors.New("unable to read exec response"), err)
+	}
+
+	var exitCode int
+
 	err = waitForExecutionUntilTimeout(ctx, func() (bool, error) {
 		execStatus, err := d.cli.ContainerExecInspect(ctx, execResp.ID)
 
@@ -397,24 +461,141 @@ func (d *DockerRuntime) Exec(ctx context.Context, node *Node, cmd []string) (*st
 			return false, err
 		}
 
-		if execStatus.Running {
-			return false, nil
-		}
+		exitCode = execStatus.ExitCode
 
-		return true, nil
+		return !execStatus.Running, nil
 	}, time.Second*30)
 
 	if err != nil {
 		return nil, err
 	}
 
+	text := stdout.String()
+
+	if exitCode != 0 {
+		return &text, fmt.Errorf("command %s in node %s exited with code %d: %s", cmd[0], node.Name, exitCode, strings.TrimSpace(stderr.String()+" "+text))
+	}
+
+	return &text, nil
+}
+
+// ExecWithInput streams input to the stdin of cmd and waits for it to exit,
+// a non-zero exit code is returned as an error along with the output.
+func (d *DockerRuntime) ExecWithInput(ctx context.Context, node *Node, cmd []string, input io.Reader) (*string, error) {
+	execConfig := types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdin:  true,
+		AttachStderr: true,
+		AttachStdout: true,
+		Tty:          false,
+	}
+
+	execResp, err := d.cli.ContainerExecCreate(ctx, node.Id, execConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.cli.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{
+		Tty: execConfig.Tty,
+	})
+
+	if err != nil {
+		return nil, errors.Join(errors.New("unable to attach to exec"), err)
+	}
+
+	defer resp.Close()
+
+	copyErr := make(chan error, 1)
+
+	go func() {
+		_, err := io.Copy(resp.Conn, input)
+
+		if closeErr := resp.CloseWrite(); err == nil {
+			err = closeErr
+		}
+
+		copyErr <- err
+	}()
+
 	buff := bytes.NewBuffer([]byte{})
-	stdcopy.StdCopy(buff, nil, resp.Reader)
+
+	if _, err := stdcopy.StdCopy(buff, buff, resp.Reader); err != nil {
+		return nil, errors.Join(errors.New("unable to read exec response"), err)
+	}
+
+	if err := <-copyErr; err != nil {
+		return nil, errors.Join(errors.New("unable to write exec input"), err)
+	}
+
 	text := buff.String()
 
+	execStatus, err := d.cli.ContainerExecInspect(ctx, execResp.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if execStatus.ExitCode != 0 {
+		return &text, fmt.Errorf("command %s in node %s exited with code %d: %s", cmd[0], node.Name, execStatus.ExitCode, strings.TrimSpace(text))
+	}
+
 	return &text, nil
 }
 
+// labelFilters builds docker label filters, a label with an empty value
+// matches every object that has the label regardless of its value.
+func labelFilters(labels map[string]string) filters.Args {
+	args := filters.NewArgs()
+
+	for k, v := range labels {
+		if v == "" {
+			args.Add("label", k)
+			continue
+		}
+
+		args.Add("label", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	return args
+}
+
+func (d *DockerRuntime) WriteFile(ctx context.Context, node *Node, file *FileInNode) error {
+	return d.writeToNode(ctx, file.Content, file.Path, file.FileMode, node.Id)
+}
+
+func (d *DockerRuntime) ReadFile(ctx context.Context, node *Node, path string) ([]byte, error) {
+	reader, _, err := d.cli.CopyFromContainer(ctx, node.Id, path)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy %s from container '%s': %w", path, node.Name, err)
+	}
+
+	defer reader.Close()
+
+	tarReader := tar.NewReader(reader)
+
+	for {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			return nil, fmt.Errorf("file %s not found in container '%s'", path, node.Name)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar content: %w", err)
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			return io.ReadAll(tarReader)
+		}
+	}
+}
+
+func (d *DockerRuntime) SaveImages(ctx context.Context, images []string) (io.ReadCloser, error) {
+	return d.cli.ImageSave(ctx, images)
+}
+
 func (d *DockerRuntime) RemoveVolume(ctx context.Context, name string) error {
 	err := d.cli.VolumeRemove(ctx, name, false)
 
@@ -5,15 +5,24 @@ import (
 	"io"
 	"log"
 	"os"
+	"time"
 
 	"github.com/docker/go-connections/nat"
 )
 
 type Node struct {
-	Id     string
-	Name   string
-	Ip     string
-	Labels map[string]string
+	Id      string
+	Name    string
+	Ip      string
+	Labels  map[string]string
+	State   string
+	Created time.Time
+	Ports   map[nat.Port][]nat.PortBinding
+}
+
+// IsRunning reports whether the node's container is currently running.
+func (n *Node) IsRunning() bool {
+	return n.State == "running"
 }
 
 type Network struct {
@@ -36,6 +45,14 @@ type NodeConfig struct {
 	Labels      map[string]string
 	ExtraCerts  []string
 	Files       []*FileInNode
+	// NetworkAliases resolve to every running node sharing them.
+	NetworkAliases []string
+}
+
+type LogsOptions struct {
+	Follow bool
+	// Since is a timestamp or a duration relative to now, like 10m.
+	Since string
 }
 
 type Volume struct {
@@ -52,8 +69,11 @@ type FileInNode struct {
 
 type Runtime interface {
 	CreateNetwork(ctx context.Context, name string, labels map[string]string) error
+	DeleteNetwork(ctx context.Context, name string) error
 	RunNode(ctx context.Context, config NodeConfig) (*Node, error)
-	Logs(ctx context.Context, nodeName string, wait bool) (io.ReadCloser, error)
+	// Logs copies the logs of the node to stdout and stderr until they end, or
+	// until the context is cancelled when following them.
+	Logs(ctx context.Context, nodeName string, opts LogsOptions, stdout io.Writer, stderr io.Writer) error
 
 	StartNode(ctx context.Context, node *Node) error
 	StopNode(ctx context.Context, node *Node) error
@@ -64,8 +84,13 @@ type Runtime interface {
 	GetVolumesByLabel(ctx context.Context, labels map[string]string) ([]*Volume, error)
 
 	Exec(ctx context.Context, node *Node, cmd []string) (*string, error)
+	ExecWithInput(ctx context.Context, node *Node, cmd []string, input io.Reader) (*string, error)
+	WriteFile(ctx context.Context, node *Node, file *FileInNode) error
+	ReadFile(ctx context.Context, node *Node, path string) ([]byte, error)
 	CreateVolume(ctx context.Context, name string, labels map[string]string) error
 	RemoveVolume(ctx context.Context, name string) error
+
+	SaveImages(ctx context.Context, images []string) (io.ReadCloser, error)
 }
 
 var SelectedRuntime Runtime
@@ -0,0 +1,249 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	appDir         = "n3d"
+	clustersDir    = "clusters"
+	stateFileName  = "state.json"
+	caFileName     = "ca.pem"
+	userConfigFile = "config.yaml"
+	stateFileMode  = 0600
+	stateDirMode   = 0700
+	configDirEnv   = "N3D_CONFIG_DIR"
+)
+
+var ErrorInvalidClusterName = errors.New("invalid cluster name")
+
+// ClusterState holds the secrets of a cluster which can't be recovered from the runtime.
+type ClusterState struct {
+	VaultUnsealKey string `json:"vaultUnsealKey,omitempty"`
+	VaultRootToken string `json:"vaultRootToken,omitempty"`
+	NomadACLToken  string `json:"nomadACLToken,omitempty"`
+	// VaultNomadToken is the orphan periodic vault token of the nomad servers.
+	VaultNomadToken string `json:"vaultNomadToken,omitempty"`
+	// Consul acl tokens, the management token is only set when consul acl is enabled.
+	ConsulManagementToken  string `json:"consulManagementToken,omitempty"`
+	ConsulVaultToken       string `json:"consulVaultToken,omitempty"`
+	ConsulNomadServerToken string `json:"consulNomadServerToken,omitempty"`
+	ConsulNomadClientToken string `json:"consulNomadClientToken,omitempty"`
+	// TLS CA of the cluster, only set when tls is enabled.
+	TLSCACert string `json:"tlsCACert,omitempty"`
+	TLSCAKey  string `json:"tlsCAKey,omitempty"`
+	// Gossip encryption keys, empty for clusters created before encryption was supported.
+	ConsulGossipKey string `json:"consulGossipKey,omitempty"`
+	NomadGossipKey  string `json:"nomadGossipKey,omitempty"`
+	// NomadWorkloadIdentity is set when jobs log in to vault with their workload identity.
+	NomadWorkloadIdentity bool `json:"nomadWorkloadIdentity,omitempty"`
+	// Node counts of the cluster, a repair recreates the missing nodes from
+	// them. Nil for clusters created before the counts were recorded.
+	NomadServers  *int `json:"nomadServers,omitempty"`
+	NomadWorkers  *int `json:"nomadWorkers,omitempty"`
+	ConsulServers *int `json:"consulServers,omitempty"`
+}
+
+// UserConfig holds the user preferences, like the cluster commands default to.
+type UserConfig struct {
+	CurrentContext string `yaml:"currentContext,omitempty"`
+}
+
+// Dir returns the directory n3d keeps its state in, N3D_CONFIG_DIR overrides the default location.
+func Dir() (string, error) {
+	if dir := os.Getenv(configDirEnv); dir != "" {
+		return dir, nil
+	}
+
+	dir, err := os.UserConfigDir()
+
+	if err != nil {
+		return "", fmt.Errorf("unable to find user config dir: %w", err)
+	}
+
+	return filepath.Join(dir, appDir), nil
+}
+
+// ClusterDir returns the state directory of the cluster, names which would
+// point outside of the clusters directory are rejected.
+func ClusterDir(clusterName string) (string, error) {
+	if clusterName == "" || clusterName == "." || clusterName == ".." || strings.ContainsAny(clusterName, `/\`) {
+		return "", fmt.Errorf("%w: %q", ErrorInvalidClusterName, clusterName)
+	}
+
+	dir, err := Dir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, clustersDir, clusterName), nil
+}
+
+// ClusterExists reports whether state is stored for the cluster.
+func ClusterExists(clusterName string) (bool, error) {
+	dir, err := ClusterDir(clusterName)
+
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(filepath.Join(dir, stateFileName))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("unable to read cluster state: %w", err)
+	}
+
+	return true, nil
+}
+
+// LoadCluster returns an empty state when the cluster has no state stored yet.
+func LoadCluster(clusterName string) (*ClusterState, error) {
+	dir, err := ClusterDir(clusterName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, stateFileName))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ClusterState{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cluster state: %w", err)
+	}
+
+	state := &ClusterState{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("unable to parse cluster state: %w", err)
+	}
+
+	return state, nil
+}
+
+func SaveCluster(clusterName string, state *ClusterState) error {
+	dir, err := ClusterDir(clusterName)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, stateDirMode); err != nil {
+		return fmt.Errorf("unable to create cluster state dir: %w", err)
+	}
+
+	content, err := json.MarshalIndent(state, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, stateFileName), content, stateFileMode); err != nil {
+		return fmt.Errorf("unable to write cluster state: %w", err)
+	}
+
+	return nil
+}
+
+// CAFile returns the path of the CA certificate the CLIs on the host trust.
+func CAFile(clusterName string) (string, error) {
+	dir, err := ClusterDir(clusterName)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, caFileName), nil
+}
+
+// SaveCA writes the CA certificate next to the cluster state, the key is only kept in the state.
+func SaveCA(clusterName string, cert []byte) error {
+	path, err := CAFile(clusterName)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), stateDirMode); err != nil {
+		return fmt.Errorf("unable to create cluster state dir: %w", err)
+	}
+
+	if err := os.WriteFile(path, cert, 0644); err != nil {
+		return fmt.Errorf("unable to write ca certificate: %w", err)
+	}
+
+	return nil
+}
+
+func RemoveCluster(clusterName string) error {
+	dir, err := ClusterDir(clusterName)
+
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+func LoadUserConfig() (*UserConfig, error) {
+	dir, err := Dir()
+
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, userConfigFile))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return &UserConfig{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read user config: %w", err)
+	}
+
+	config := &UserConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("unable to parse user config: %w", err)
+	}
+
+	return config, nil
+}
+
+func SaveUserConfig(config *UserConfig) error {
+	dir, err := Dir()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, stateDirMode); err != nil {
+		return fmt.Errorf("unable to create config dir: %w", err)
+	}
+
+	content, err := yaml.Marshal(config)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, userConfigFile), content, stateFileMode); err != nil {
+		return fmt.Errorf("unable to write user config: %w", err)
+	}
+
+	return nil
+}
@@ -1,26 +1,48 @@
 package vault
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"n3d/certs"
 	"n3d/constants"
 	"n3d/runtimes"
+	"n3d/wait"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-const vaultImage = "vault:1.13.3"
+const (
+	DefaultVersion      = "1.13.3"
+	defaultReadyTimeout = time.Minute * 2
+)
 
 type VaultConfiguration struct {
 	ClusterName string
 	ConsulAddr  string
 	NetworkName string
 	Id          int
+	// UnsealKey and RootToken of an already initialized storage, used when
+	// vault is recreated on top of existing consul data.
+	UnsealKey    string
+	RootToken    string
+	ReadyTimeout time.Duration
+	Version      string
+	// Image overrides the image of the version.
+	Image string
+	// ConsulToken is used by the consul storage when consul acl is enabled.
+	ConsulToken string
+	// TLS serves the api over https and makes the storage use https to reach consul.
+	TLS *certs.NodeCerts
+}
+
+// Image returns the vault image of the version, the official vault image
+// isn't published anymore since 1.14.
+func Image(version string) string {
+	return fmt.Sprintf("hashicorp/vault:%s", version)
 }
 
 type VaultNode struct {
@@ -34,23 +56,45 @@ type vaultInitResponse struct {
 	RootToken  string   `json:"root_token"`
 }
 
+type HealthResponse struct {
+	Initialized bool   `json:"initialized"`
+	Sealed      bool   `json:"sealed"`
+	Version     string `json:"version"`
+}
+
+func NodeName(clusterName string, id int) string {
+	return fmt.Sprintf("%s-vault-%d", clusterName, id)
+}
+
 func NewVault(ctx context.Context, runtime runtimes.Runtime, config VaultConfiguration) (*VaultNode, error) {
-	nodeName := fmt.Sprintf("%s-vault-%d", config.ClusterName, config.Id)
+	nodeName := NodeName(config.ClusterName, config.Id)
+
+	version, image := config.Version, config.Image
+	if image == "" {
+		if version == "" {
+			version = DefaultVersion
+		}
+
+		image = Image(version)
+	}
+
 	vaultConfig := `
 	    ui            = true
 	    log_level     = "trace"
 		cluster_addr  = "http://127.0.0.1:8201"
-        api_addr      = "http://127.0.0.1:8200"
+        api_addr      = "%s://127.0.0.1:8200"
 		cluster_name  = "%s"
 
 		storage "consul" {
 			address = "%s"
 			path = "vault/"
+			token = "%s"
+			%s
 		}
 		listener "tcp" {
 			address = "0.0.0.0:8200"
 			cluster_address  = "0.0.0.0:8201"
-			tls_disable = 1
+			%s
 		}
 		
 		max_lease_ttl = "9000h"
@@ -58,39 +102,75 @@ func NewVault(ctx context.Context, runtime runtimes.Runtime, config VaultConfigu
 		ui = true		
 	`
 
-	vaultConfig = fmt.Sprintf(vaultConfig, config.ClusterName, config.ConsulAddr)
+	scheme, storageTLS, listenerTLS := "http", "", "tls_disable = 1"
+	labels := map[string]string{
+		constants.NodeType:    constants.Vault,
+		constants.ClusterName: config.ClusterName,
+		constants.Version:     version,
+		constants.Image:       image,
+	}
+
+	files := []*runtimes.FileInNode{}
+	env := []string{}
+
+	if config.TLS != nil {
+		scheme = "https"
+		storageTLS = fmt.Sprintf(`scheme = "https"
+			tls_ca_file = "%s"`, certs.CAPath)
+		listenerTLS = fmt.Sprintf(`tls_cert_file = "%s"
+			tls_key_file = "%s"`, certs.CertPath, certs.KeyPath)
+		files = config.TLS.Files()
+		env = append(env, "VAULT_CACERT="+certs.CAPath)
+		labels[constants.TLS] = "true"
+	}
+
+	vaultConfig = fmt.Sprintf(vaultConfig, scheme, config.ClusterName, config.ConsulAddr, config.ConsulToken, storageTLS, listenerTLS)
 
 	ctn, err := runtime.RunNode(ctx, runtimes.NodeConfig{
 		Name:        nodeName,
-		Image:       vaultImage,
+		Image:       image,
 		NetworkName: config.NetworkName,
 		Privileged:  true,
 		Cmd:         []string{"server"},
-		Files: []*runtimes.FileInNode{
-			{
-				Content:  []byte(vaultConfig),
-				Path:     "/vault/config/vault.hcl",
-				FileMode: 0644,
-			},
-		},
-		Labels: map[string]string{
-			constants.NodeType:    constants.Vault,
-			constants.ClusterName: config.ClusterName,
-		},
+		Env:         env,
+		Files: append(files, &runtimes.FileInNode{
+			Content:  []byte(vaultConfig),
+			Path:     "/vault/config/vault.hcl",
+			FileMode: 0644,
+		}),
+		Labels: labels,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = waitForVault(ctx, runtime, ctn)
+	timeout := config.ReadyTimeout
+	if timeout == 0 {
+		timeout = defaultReadyTimeout
+	}
+
+	err = WaitForAPI(ctx, runtime, ctn, timeout)
 
 	if err != nil {
 		return nil, errors.Join(errors.New("unable to check vault status"), err)
 	}
 
-	cmd := []string{"vault", "operator", "init", "-key-shares=1", "-key-threshold=1", "-format=json", "-address=http://127.0.0.1:8200"}
-	//cmd := []string{"ls", "-l"}
+	status, err := Health(ctx, runtime, ctn)
+
+	if err != nil {
+		return nil, errors.Join(errors.New("unable to check vault status"), err)
+	}
+
+	node := &VaultNode{Node: ctn, UnsealKey: config.UnsealKey, RootToken: config.RootToken}
+
+	if status.Initialized {
+		log.WithContext(ctx).WithField("name", nodeName).Info("vault storage is already initialized, unsealing.")
+
+		return node, Unseal(ctx, runtime, node, timeout)
+	}
+
+	cmd := []string{"vault", "operator", "init", "-key-shares=1", "-key-threshold=1", "-format=json", "-address=" + address(ctn)}
 
 	respText, err := runtime.Exec(ctx, ctn, cmd)
 
@@ -101,35 +181,311 @@ func NewVault(ctx context.Context, runtime runtimes.Runtime, config VaultConfigu
 	respObj := &vaultInitResponse{}
 	err = json.Unmarshal([]byte(*respText), respObj)
 
+	// the response holds the unseal key and root token, it is never logged
 	if err != nil {
-		log.Info(*respText)
-		return nil, errors.Join(fmt.Errorf("unable to parse vault response: %s", *respText), err)
+		return nil, fmt.Errorf("unable to parse vault init response of %d bytes: %w", len(*respText), err)
+	}
+
+	if len(respObj.UnsealKeys) == 0 || respObj.RootToken == "" {
+		return nil, errors.New("vault init response has no unseal key or root token")
+	}
+
+	node.UnsealKey = respObj.UnsealKeys[0]
+	node.RootToken = respObj.RootToken
+
+	return node, Unseal(ctx, runtime, node, timeout)
+}
+
+// Health reads the seal status with the vault cli, which verifies the api
+// with the VAULT_CACERT of the node. The cli exits with 2 while vault is sealed
+// or uninitialized, the status is printed nonetheless.
+func Health(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node) (*HealthResponse, error) {
+	respText, err := runtime.Exec(ctx, node, []string{"vault", "status", "-format=json", "-address=" + address(node)})
+
+	if respText == nil || strings.TrimSpace(*respText) == "" {
+		if err == nil {
+			err = errors.New("vault status is empty")
+		}
+
+		return nil, err
+	}
+
+	health := &HealthResponse{}
+	if err := json.Unmarshal([]byte(*respText), health); err != nil {
+		return nil, fmt.Errorf("unable to parse vault health: %q: %w", *respText, err)
+	}
+
+	return health, nil
+}
+
+// WaitForAPI waits until the vault API responds, regardless of its seal status.
+func WaitForAPI(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, timeout time.Duration) error {
+	return wait.For(ctx, "vault api", timeout, func(ctx context.Context) (bool, error) {
+		_, err := Health(ctx, runtime, node)
+
+		return err == nil, err
+	})
+}
+
+func WaitForUnsealed(ctx context.Context, runtime runtimes.Runtime, node *runtimes.Node, timeout time.Duration) error {
+	return wait.For(ctx, "vault unsealed", timeout, func(ctx context.Context) (bool, error) {
+		health, err := Health(ctx, runtime, node)
+
+		if err != nil {
+			return false, err
+		}
+
+		return health.Initialized && !health.Sealed, nil
+	})
+}
+
+// Unseal unseals vault with the stored unseal key and waits until vault reports it is unsealed.
+func Unseal(ctx context.Context, runtime runtimes.Runtime, node *VaultNode, timeout time.Duration) error {
+	if node.UnsealKey == "" {
+		return errors.New("unseal key is unknown")
 	}
 
-	return &VaultNode{Node: ctn, UnsealKey: respObj.UnsealKeys[0], RootToken: respObj.RootToken}, nil
+	if err := WaitForAPI(ctx, runtime, node.Node, timeout); err != nil {
+		return err
+	}
+
+	cmd := []string{"vault", "operator", "unseal", "-address=" + address(node.Node), node.UnsealKey}
+
+	if _, err := runtime.Exec(ctx, node.Node, cmd); err != nil {
+		return errors.Join(errors.New("unable to unseal vault"), err)
+	}
+
+	return WaitForUnsealed(ctx, runtime, node.Node, timeout)
+}
+
+const (
+	NomadServerPolicy = "nomad-server"
+	NomadClusterRole  = "nomad-cluster"
+	// nomadTokenPeriod is longer than the 72h of the nomad guide, so a stopped
+	// cluster doesn't lose its token over a weekend.
+	nomadTokenPeriod = "8760h"
+)
+
+// nomadServerPolicyRules follow the nomad vault integration guide.
+const nomadServerPolicyRules = `
+path "auth/token/create/nomad-cluster" {
+  capabilities = ["update"]
 }
 
-func waitForVault(ctx context.Context, runtime runtimes.Runtime, container *runtimes.Node) error {
-	timeoutCtx, cancelFunc := context.WithTimeout(ctx, time.Second*30)
-	defer cancelFunc()
+path "auth/token/roles/nomad-cluster" {
+  capabilities = ["read"]
+}
 
-	logs, err := runtime.Logs(timeoutCtx, container.Name, true)
+path "auth/token/lookup-self" {
+  capabilities = ["read"]
+}
+
+path "auth/token/lookup" {
+  capabilities = ["update"]
+}
+
+path "auth/token/revoke-accessor" {
+  capabilities = ["update"]
+}
+
+path "sys/capabilities-self" {
+  capabilities = ["update"]
+}
+
+path "auth/token/renew-self" {
+  capabilities = ["update"]
+}
+`
+
+type tokenCreateResponse struct {
+	Auth struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+}
+
+// NomadToken creates the nomad-server policy and the nomad-cluster token role,
+// then issues an orphan periodic token nomad servers derive job tokens with.
+func NomadToken(ctx context.Context, runtime runtimes.Runtime, node *VaultNode) (string, error) {
+	_, err := runtime.ExecWithInput(ctx, node.Node, vaultCmd(node, "policy", "write", NomadServerPolicy, "-"), strings.NewReader(nomadServerPolicyRules))
+
+	if err != nil {
+		return "", fmt.Errorf("unable to write vault policy %s: %w", NomadServerPolicy, err)
+	}
+
+	_, err = runtime.ExecWithInput(ctx, node.Node, vaultCmd(node, "write", "auth/token/roles/"+NomadClusterRole,
+		"disallowed_policies="+NomadServerPolicy,
+		"token_explicit_max_ttl=0",
+		"orphan=true",
+		"token_period="+nomadTokenPeriod,
+		"renewable=true",
+	), strings.NewReader(""))
+
+	if err != nil {
+		return "", fmt.Errorf("unable to write vault token role %s: %w", NomadClusterRole, err)
+	}
+
+	// only stdout is read, warnings on stderr would break the json
+	respText, err := runtime.Exec(ctx, node.Node, vaultCmd(node, "token", "create",
+		"-policy="+NomadServerPolicy,
+		"-period="+nomadTokenPeriod,
+		"-orphan",
+		"-format=json",
+	))
+
+	if err != nil {
+		return "", fmt.Errorf("unable to create nomad vault token: %w", err)
+	}
+
+	resp := &tokenCreateResponse{}
+	if err := json.Unmarshal([]byte(*respText), resp); err != nil || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("unable to parse vault token response of %d bytes", len(*respText))
+	}
+
+	return resp.Auth.ClientToken, nil
+}
+
+const (
+	// NomadJWTPath is the default auth path nomad clients log in with workload identities.
+	NomadJWTPath = "jwt-nomad"
+	// NomadWorkloadsRole is the default role of the jwt auth method.
+	NomadWorkloadsRole     = "nomad-workloads"
+	NomadWorkloadsPolicy   = "nomad-workloads"
+	NomadIdentityAudience  = "vault.io"
+	nomadWorkloadsTokenTTL = "30m"
+)
+
+// nomadWorkloadsPolicyRules follow the nomad workload identity guide, jobs
+// read the kv secrets under their namespace and job id.
+const nomadWorkloadsPolicyRules = `
+path "secret/data/{{identity.entity.aliases.%[1]s.metadata.nomad_namespace}}/{{identity.entity.aliases.%[1]s.metadata.nomad_job_id}}/*" {
+  capabilities = ["read"]
+}
+
+path "secret/data/{{identity.entity.aliases.%[1]s.metadata.nomad_namespace}}/{{identity.entity.aliases.%[1]s.metadata.nomad_job_id}}" {
+  capabilities = ["read"]
+}
+
+path "secret/metadata/{{identity.entity.aliases.%[1]s.metadata.nomad_namespace}}/*" {
+  capabilities = ["list"]
+}
+
+path "secret/metadata/*" {
+  capabilities = ["list"]
+}
+`
+
+const nomadWorkloadsRole = `{
+  "role_type": "jwt",
+  "bound_audiences": ["%s"],
+  "user_claim": "/nomad_job_id",
+  "user_claim_json_pointer": true,
+  "claim_mappings": {
+    "nomad_namespace": "nomad_namespace",
+    "nomad_job_id": "nomad_job_id",
+    "nomad_task": "nomad_task"
+  },
+  "token_type": "service",
+  "token_policies": ["%s"],
+  "token_period": "%s",
+  "token_explicit_max_ttl": 0
+}`
+
+type mount struct {
+	Accessor string `json:"accessor"`
+}
+
+// ConfigureWorkloadIdentity enables the jwt auth method against the jwks of
+// the nomad servers and creates its default role, the kv secrets the role
+// grants access to are mounted at secret/. It is retried until nomad
+// serves its keys, vault fetches them when the config is written.
+func ConfigureWorkloadIdentity(ctx context.Context, runtime runtimes.Runtime, node *VaultNode, jwksURL string, timeout time.Duration) error {
+	secrets, err := mounts(ctx, runtime, node, "secrets")
 
 	if err != nil {
 		return err
 	}
 
-	defer logs.Close()
+	if _, ok := secrets["secret/"]; !ok {
+		if _, err := runtime.ExecWithInput(ctx, node.Node, vaultCmd(node, "secrets", "enable", "-path=secret", "kv-v2"), strings.NewReader("")); err != nil {
+			return fmt.Errorf("unable to enable vault kv secrets: %w", err)
+		}
+	}
 
-	scanner := bufio.NewScanner(logs)
+	auths, err := mounts(ctx, runtime, node, "auth")
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	if err != nil {
+		return err
+	}
 
-		if strings.Contains(line, "core: Initializing version history cache for core") {
-			break
+	if _, ok := auths[NomadJWTPath+"/"]; !ok {
+		if _, err := runtime.ExecWithInput(ctx, node.Node, vaultCmd(node, "auth", "enable", "-path="+NomadJWTPath, "jwt"), strings.NewReader("")); err != nil {
+			return fmt.Errorf("unable to enable vault jwt auth: %w", err)
 		}
+
+		if auths, err = mounts(ctx, runtime, node, "auth"); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"write", "auth/" + NomadJWTPath + "/config",
+		"jwks_url=" + jwksURL,
+		"jwt_supported_algs=RS256,EdDSA",
+		"default_role=" + NomadWorkloadsRole,
+	}
+
+	if certs.Scheme(node.Node) == "https" {
+		args = append(args, "jwks_ca_pem=@"+certs.CAPath)
+	}
+
+	err = wait.For(ctx, "vault jwt auth config", timeout, func(ctx context.Context) (bool, error) {
+		_, err := runtime.ExecWithInput(ctx, node.Node, vaultCmd(node, args...), strings.NewReader(""))
+
+		return err == nil, err
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to configure vault jwt auth: %w", err)
+	}
+
+	rules := fmt.Sprintf(nomadWorkloadsPolicyRules, auths[NomadJWTPath+"/"].Accessor)
+
+	if _, err := runtime.ExecWithInput(ctx, node.Node, vaultCmd(node, "policy", "write", NomadWorkloadsPolicy, "-"), strings.NewReader(rules)); err != nil {
+		return fmt.Errorf("unable to write vault policy %s: %w", NomadWorkloadsPolicy, err)
+	}
+
+	role := fmt.Sprintf(nomadWorkloadsRole, NomadIdentityAudience, NomadWorkloadsPolicy, nomadWorkloadsTokenTTL)
+
+	if _, err := runtime.ExecWithInput(ctx, node.Node, vaultCmd(node, "write", "auth/"+NomadJWTPath+"/role/"+NomadWorkloadsRole, "-"), strings.NewReader(role)); err != nil {
+		return fmt.Errorf("unable to write vault role %s: %w", NomadWorkloadsRole, err)
 	}
 
 	return nil
 }
+
+// mounts lists the auth methods or the secrets engines by their path.
+func mounts(ctx context.Context, runtime runtimes.Runtime, node *VaultNode, kind string) (map[string]mount, error) {
+	respText, err := runtime.Exec(ctx, node.Node, vaultCmd(node, kind, "list", "-format=json"))
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to list vault %s mounts: %w", kind, err)
+	}
+
+	result := make(map[string]mount)
+	if err := json.Unmarshal([]byte(*respText), &result); err != nil {
+		return nil, fmt.Errorf("unable to parse vault %s mounts: %q: %w", kind, *respText, err)
+	}
+
+	return result, nil
+}
+
+// vaultCmd builds a vault cli command against the local api, the cli only reads the token from the environment.
+func vaultCmd(node *VaultNode, args ...string) []string {
+	cmd := []string{"env", "VAULT_ADDR=" + address(node.Node), "VAULT_TOKEN=" + node.RootToken, "vault"}
+
+	return append(cmd, args...)
+}
+
+// address returns the address of the api inside the node, the certificates are valid for 127.0.0.1.
+func address(node *runtimes.Node) string {
+	return certs.Scheme(node) + "://127.0.0.1:8200"
+}
@@ -0,0 +1,157 @@
+package versions
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrorUnsupportedVersions = errors.New("unsupported version combination")
+
+// Versions of the cluster components, an empty version is unknown and not validated.
+type Versions struct {
+	Nomad  string
+	Consul string
+	Vault  string
+}
+
+// compatibility lists the consul and vault minor versions a nomad minor version is tested with.
+type compatibility struct {
+	nomad  string
+	consul [2]string
+	vault  [2]string
+}
+
+var compatibilityTable = []compatibility{
+	{nomad: "1.5", consul: [2]string{"1.13", "1.16"}, vault: [2]string{"1.11", "1.14"}},
+	{nomad: "1.6", consul: [2]string{"1.14", "1.17"}, vault: [2]string{"1.12", "1.15"}},
+	{nomad: "1.7", consul: [2]string{"1.15", "1.18"}, vault: [2]string{"1.13", "1.16"}},
+	{nomad: "1.8", consul: [2]string{"1.16", "1.19"}, vault: [2]string{"1.14", "1.17"}},
+}
+
+// Check validates the combination against the compatibility table.
+func Check(v Versions) error {
+	if v.Nomad == "" {
+		return nil
+	}
+
+	nomadMinor, ok := minor(v.Nomad)
+
+	if !ok {
+		return fmt.Errorf("invalid nomad version %q", v.Nomad)
+	}
+
+	var entry *compatibility
+
+	for i := range compatibilityTable {
+		if compareMinor(compatibilityTable[i].nomad, nomadMinor) == 0 {
+			entry = &compatibilityTable[i]
+		}
+	}
+
+	if entry == nil {
+		return fmt.Errorf("%w: nomad %s isn't supported, supported nomad versions are %s", ErrorUnsupportedVersions, v.Nomad, supportedNomad())
+	}
+
+	if err := checkRange("consul", v.Consul, v.Nomad, entry.consul); err != nil {
+		return err
+	}
+
+	return checkRange("vault", v.Vault, v.Nomad, entry.vault)
+}
+
+// AtLeast reports whether the version is the given minor version or newer,
+// an unknown version is assumed to be new enough.
+func AtLeast(version string, minimum string) bool {
+	m, ok := minor(version)
+
+	if !ok {
+		return true
+	}
+
+	return compareMinor(m, minimum) >= 0
+}
+
+// TagOf returns the tag of an image reference when it looks like a version.
+func TagOf(image string) string {
+	idx := strings.LastIndex(image, ":")
+
+	if idx < 0 || strings.Contains(image[idx:], "/") {
+		return ""
+	}
+
+	tag := strings.TrimPrefix(image[idx+1:], "v")
+
+	if _, ok := minor(tag); !ok {
+		return ""
+	}
+
+	return tag
+}
+
+func checkRange(component string, version string, nomadVersion string, supported [2]string) error {
+	if version == "" {
+		return nil
+	}
+
+	m, ok := minor(version)
+
+	if !ok {
+		return fmt.Errorf("invalid %s version %q", component, version)
+	}
+
+	if compareMinor(m, supported[0]) < 0 || compareMinor(m, supported[1]) > 0 {
+		return fmt.Errorf("%w: %s %s with nomad %s, supported %s versions are %s to %s",
+			ErrorUnsupportedVersions, component, version, nomadVersion, component, supported[0], supported[1])
+	}
+
+	return nil
+}
+
+func supportedNomad() string {
+	minors := make([]string, 0, len(compatibilityTable))
+
+	for _, c := range compatibilityTable {
+		minors = append(minors, c.nomad)
+	}
+
+	return strings.Join(minors, ", ")
+}
+
+// minor returns major.minor of a version like 1.6.3 or 1.7.0-beta.1.
+func minor(version string) (string, bool) {
+	parts := strings.SplitN(version, ".", 3)
+
+	if len(parts) < 2 {
+		return "", false
+	}
+
+	for _, p := range parts[:2] {
+		if _, err := strconv.Atoi(p); err != nil {
+			return "", false
+		}
+	}
+
+	return parts[0] + "." + parts[1], true
+}
+
+func compareMinor(a string, b string) int {
+	ap := strings.Split(a, ".")
+	bp := strings.Split(b, ".")
+
+	for i := 0; i < 2; i++ {
+		x, _ := strconv.Atoi(ap[i])
+		y, _ := strconv.Atoi(bp[i])
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return 0
+}
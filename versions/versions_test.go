@@ -0,0 +1,40 @@
+package versions
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		versions    Versions
+		wantErr     bool
+		unsupported bool
+	}{
+		{name: "unknown nomad", versions: Versions{Consul: "1.0.0", Vault: "0.1.0"}},
+		{name: "nomad only", versions: Versions{Nomad: "1.6.3"}},
+		{name: "supported", versions: Versions{Nomad: "1.6.3", Consul: "1.16.2", Vault: "1.15.1"}},
+		{name: "range bounds", versions: Versions{Nomad: "1.7.2", Consul: "1.15.0", Vault: "1.16.0"}},
+		{name: "prerelease", versions: Versions{Nomad: "1.8.0-beta.1", Consul: "1.19.0-rc1"}},
+		{name: "unsupported nomad", versions: Versions{Nomad: "1.4.0"}, wantErr: true, unsupported: true},
+		{name: "consul too old", versions: Versions{Nomad: "1.6.3", Consul: "1.13.9"}, wantErr: true, unsupported: true},
+		{name: "vault too new", versions: Versions{Nomad: "1.5.0", Vault: "1.15.0"}, wantErr: true, unsupported: true},
+		{name: "invalid nomad", versions: Versions{Nomad: "latest"}, wantErr: true},
+		{name: "invalid consul", versions: Versions{Nomad: "1.6.3", Consul: "1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.versions)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if errors.Is(err, ErrorUnsupportedVersions) != tt.unsupported {
+				t.Errorf("Check() error = %v, unsupported %v", err, tt.unsupported)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const interval = time.Second
+
+var ErrTimeout = errors.New("timed out waiting")
+
+// Condition reports whether the awaited state is reached, errors are treated
+// as not ready yet since services refuse connections while starting.
+type Condition func(ctx context.Context) (bool, error)
+
+// For polls the condition until it is met or the timeout expires.
+func For(ctx context.Context, name string, timeout time.Duration, condition Condition) error {
+	timeoutCtx, cancelFunc := context.WithTimeout(ctx, timeout)
+	defer cancelFunc()
+
+	var lastErr error
+
+	for {
+		ready, err := condition(timeoutCtx)
+
+		if err == nil && ready {
+			log.WithContext(ctx).WithField("for", name).Debug("condition met")
+			return nil
+		}
+
+		if err != nil {
+			lastErr = err
+			log.WithContext(ctx).WithError(err).WithField("for", name).Debug("condition not met")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeoutCtx.Done():
+			// both are done when the parent is cancelled, which isn't a timeout
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if lastErr != nil {
+				return fmt.Errorf("%w for %s after %s: %w", ErrTimeout, name, timeout, lastErr)
+			}
+
+			return fmt.Errorf("%w for %s after %s", ErrTimeout, name, timeout)
+		case <-time.After(interval):
+		}
+	}
+}